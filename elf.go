@@ -0,0 +1,109 @@
+package gen
+
+import (
+
+	// Standard packages
+	"bytes"
+	"debug/elf"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+/*
+ *******************************************************************************
+ *                            Private ELF Functions                            *
+ *******************************************************************************
+*/
+
+// Checks that the shared (.so) and static (.a) libraries to copy were built for
+// the target machine (if configured). Other files are not checked
+func check_libraries (meta Metadata) error {
+	if meta.Target_machine == elf.EM_NONE {
+		return nil
+	}
+	for _, path := range meta.Libraries {
+		var err error = nil
+		switch {
+		case strings.HasSuffix(path, ".a"):
+			err = check_archive_machine(path, meta.Target_machine)
+		case strings.HasSuffix(path, ".so") || strings.Contains(path, ".so."):
+			err = check_elf_machine(path, meta.Target_machine)
+		}
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the machine of a shared library
+func check_elf_machine (path string, machine elf.Machine) error {
+	f, err := elf.Open(path)
+	if nil != err {
+		return errors.New("Unable to read ELF header (" + path + "): " + err.Error())
+	}
+	defer f.Close()
+
+	if f.Machine != machine {
+		return fmt.Errorf("library %s is built for %s (target: %s)", path, f.Machine, machine)
+	}
+	return nil
+}
+
+// Checks the machine of every ELF object in a static library (ar archive)
+func check_archive_machine (path string, machine elf.Machine) error {
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return errors.New("Unable to read archive (" + path + "): " + err.Error())
+	}
+
+	// Check: archive magic
+	magic := "!<arch>\n"
+	if !bytes.HasPrefix(data, []byte(magic)) {
+		return errors.New("Not an ar archive: " + path)
+	}
+
+	// Walk the members (60 byte headers, data padded to an even size)
+	for offset := len(magic); offset < len(data); {
+		if offset + 60 > len(data) {
+			return errors.New("Truncated archive member header (" + path + ")")
+		}
+		header := data[offset:offset + 60]
+		name := strings.TrimSpace(string(header[0:16]))
+		size, err := strconv.Atoi(strings.TrimSpace(string(header[48:58])))
+		offset += 60
+		if nil != err || size < 0 || offset + size > len(data) {
+			return errors.New("Malformed archive member header (" + path + ")")
+		}
+		member := data[offset:offset + size]
+		offset += size + size % 2
+
+		// BSD archives store long names at the start of the member data
+		if strings.HasPrefix(name, "#1/") {
+			n, err := strconv.Atoi(name[3:])
+			if nil != err || n > len(member) {
+				return errors.New("Malformed archive member name (" + path + ")")
+			}
+			name, member = string(member[:n]), member[n:]
+		}
+		name = strings.TrimSuffix(name, "/")
+
+		// Only object files are checked (symbol tables are not ELF)
+		if !bytes.HasPrefix(member, []byte(elf.ELFMAG)) {
+			continue
+		}
+		f, err := elf.NewFile(bytes.NewReader(member))
+		if nil != err {
+			return errors.New("Unable to read ELF header (" + path + ": " + name + "): " +
+				err.Error())
+		}
+		if f.Machine != machine {
+			return fmt.Errorf("library %s (%s) is built for %s (target: %s)", path, name,
+				f.Machine, machine)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package gen
+
+import (
+
+	// Standard packages
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+ *******************************************************************************
+ *                              ELF Test Fixtures                              *
+ *******************************************************************************
+*/
+
+// Returns a minimal (header only) 64-bit ELF relocatable object for the machine
+func elf_object (t *testing.T, machine elf.Machine) []byte {
+	var b bytes.Buffer
+	header := elf.Header64{Type: uint16(elf.ET_REL), Machine: uint16(machine),
+		Version: uint32(elf.EV_CURRENT), Ehsize: 64}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	err := binary.Write(&b, binary.LittleEndian, header)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// Returns a 60 byte ar member header with the name and size field
+func ar_header (name, size string) []byte {
+	return []byte(fmt.Sprintf("%-16s%-12s%-6s%-6s%-8s%-10s`\n", name, "0", "0", "0", "644",
+		size))
+}
+
+// Returns an ar archive member: a header, and the data padded to an even size.
+// BSD long names ("#1/<n>") are stored at the start of the data
+func ar_member (name string, data []byte) []byte {
+	if strings.HasPrefix(name, "#1/") {
+		long := name[3:]
+		name, data = fmt.Sprintf("#1/%d", len(long)), append([]byte(long), data...)
+	}
+	member := append(ar_header(name, fmt.Sprint(len(data))), data...)
+	if len(data) % 2 == 1 {
+		member = append(member, '\n')
+	}
+	return member
+}
+
+// Writes an ar archive of the members into a temporary directory
+func write_archive (t *testing.T, members ...[]byte) string {
+	data := []byte("!<arch>\n")
+	for _, m := range members {
+		data = append(data, m...)
+	}
+	path := filepath.Join(t.TempDir(), "lib.a")
+	err := ioutil.WriteFile(path, data, 0666)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return path
+}
+
+/*
+ *******************************************************************************
+ *                                  ELF Tests                                  *
+ *******************************************************************************
+*/
+
+func TestCheckArchiveMachine (t *testing.T) {
+	arm, x86 := elf_object(t, elf.EM_AARCH64), elf_object(t, elf.EM_X86_64)
+	symbols := ar_member("/", []byte{0, 0, 0, 0, 0})
+
+	for _, c := range []struct{
+		name      string             // Case name
+		path      string             // Archive path
+		expected  string             // Expected error substring (empty: none)
+	}{
+		{"matching member", write_archive(t, symbols, ar_member("a.o/", arm)), ""},
+		{"mismatching member", write_archive(t, ar_member("a.o/", arm),
+			ar_member("b.o/", x86)), "(b.o) is built for EM_X86_64"},
+		{"BSD long name", write_archive(t, ar_member("#1/long_object_name.o", x86)),
+			"(long_object_name.o)"},
+		{"BSD long name matching", write_archive(t, ar_member("#1/odd.o", arm)), ""},
+		{"BSD name past the data", write_archive(t, ar_header("#1/99", "4"), []byte("ab.o")),
+			"Malformed archive member name"},
+		{"truncated header", write_archive(t, ar_member("a.o/", arm),
+			ar_header("b.o/", "64")[:30]), "Truncated archive member header"},
+		{"truncated data", write_archive(t, ar_member("a.o/", arm)[:60 + 10]),
+			"Malformed archive member header"},
+		{"malformed size", write_archive(t, ar_header("a.o/", "xx")),
+			"Malformed archive member header"},
+		{"not an archive", write_template(t, "lib.a", "not an archive"),
+			"Not an ar archive"},
+	} {
+		err := check_archive_machine(c.path, elf.EM_AARCH64)
+		switch {
+		case c.expected == "" && nil != err:
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		case c.expected != "" && (nil == err || !strings.Contains(err.Error(), c.expected)):
+			t.Errorf("%s: error = %v, expected %q", c.name, err, c.expected)
+		}
+	}
+}
+
+func TestCheckLibraries (t *testing.T) {
+	so_path := filepath.Join(t.TempDir(), "libx.so.1")
+	err := ioutil.WriteFile(so_path, elf_object(t, elf.EM_X86_64), 0666)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	meta := Metadata{Libraries: []string{so_path}, Target_machine: elf.EM_AARCH64}
+	if err := check_libraries(meta); nil == err || !strings.Contains(err.Error(), "libx.so.1") {
+		t.Errorf("error = %v, expected a machine mismatch", err)
+	}
+	meta.Target_machine = elf.EM_X86_64
+	if err := check_libraries(meta); nil != err {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
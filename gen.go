@@ -8,10 +8,20 @@ import (
 	"os/exec"
 	"io"
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"debug/elf"
 	"io/ioutil"
 	"text/template"
+	"text/template/parse"
 	"errors"
 	"strings"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
 
 	// Custom packages
 	"app"
@@ -19,6 +29,59 @@ import (
 	"graph"
 )
 
+/*
+ *******************************************************************************
+ *                              Default Settings                               *
+ *******************************************************************************
+*/
+
+const (
+	default_sync_label       = "N%d\n(SYNC)\nprio=%d"
+	default_sync_fill        = "#FFE74C"
+	default_ros_distro       = "humble"
+	default_source_extension = "cpp"
+	default_pen_width        = 1.0
+	default_border_color     = "black"
+	default_critical_color   = "red"
+	default_buildtool        = "ament_cmake"
+	default_max_nodes        = 10000
+	default_max_edges        = 100000
+	default_linter           = "ament_cpplint"
+	default_chain_graph      = "graph"
+	default_app_graph        = "application"
+	default_cluster_label    = "Chain %d"
+	default_cluster_color    = "gray"
+	default_cluster_bgcolor  = "white"
+	default_filter_arity     = 1
+)
+
+// Returned (wrapped) when a command cannot be found; retrying will not help
+var ErrCommandNotFound = errors.New("command not found")
+
+// Returned (wrapped) when a command was found but failed while running
+var ErrCommandFailed = errors.New("command failed")
+
+// Command lookup and construction (variables so tests can substitute fakes)
+var look_path = exec.LookPath
+var exec_command = exec.Command
+
+// Serializes warnings (generation tasks may run in parallel)
+var warn_lock sync.Mutex
+
+// Functions available to all templates
+var template_funcs = template.FuncMap{
+	"pythonStr":    python_string,
+	"seq":          sequence,
+	"priorityName": priority_name,
+}
+
+// Functions predefined by text/template
+var builtin_funcs = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true, "js": true,
+	"len": true, "not": true, "or": true, "print": true, "printf": true, "println": true,
+	"urlquery": true, "eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+}
+
 /*
  *******************************************************************************
  *                          Template Type Definitions                          *
@@ -33,11 +96,19 @@ type ROS_Executor struct {
 	PPE_levels     int              // How many priority levels to use with PPE
 	Executor       app.Executor     // The executor to parse
 	Duration_us    int64            // Duration (in us) to run the executor
+	Chains         []int            // Chains the executor participates in
+	Node_wcet_map  map[int]int64    // Mapping from executor node to wcet (us)
+	Node_prio_map  map[int]int      // Mapping from executor node to priority
+	Source         string           // Path of the generated source, relative to src/
+	Index          int              // Index of the executor in the application
+	Header         string           // Filename of the generated header (if any)
+	Wcet_us        int64            // Total WCET (us) of the executor's nodes
+	Filter_arity   int              // Number of inputs synchronized by the filter
 }
 
 type Metadata struct {
 	Packages       []string          // Packages to include in makefile
-	Includes       []string          // Include directives for C++ program
+	Includes       []string          // Include directives for C++ program (delimiters optional)
 	MsgType        string            // Program message type
 	PPE            int               // (0: none, 1: producer-consumer, 2: thread-dispatch)
 	PPE_levels     int               // How many priority levels to use with PPE
@@ -47,6 +118,70 @@ type Metadata struct {
 	Sources        []string          // Paths to source files to copy in
 	Duration_us    int64             // Duration (in us) to run the executor
 	Logging_mode   int               // Log (0: none, 1: callbacks, 2: chains)
+	Graph_style    Graphstyle        // Styling options for the rendered graphs
+	Dockerfile     bool              // Generate a Dockerfile for the package
+	Ros_distro     string            // ROS distribution to build against
+	Allow_empty    bool              // Permit applications without executors
+	Cpp_standard   int               // C++ standard to compile with (e.g. 17)
+	Compile_definitions []string     // Preprocessor definitions (e.g. MY_FLAG)
+	Workspace      bool              // Nest the package in a colcon workspace (src/)
+	Workspace_script bool            // Emit a top-level workspace build script
+	Source_extension string          // Extension of generated sources (default: cpp)
+	File_header    string            // Text prepended to generated files, as a comment (e.g. SPDX line)
+	Include_resolver func(string) []string // Maps the message type to includes
+	Merge_build_files bool           // Only replace the marked region of build files
+	Progress       func(string, int, int) // Called with (step, current, total)
+	Extra_dot_args []string          // Additional arguments passed to dot
+	Normalize_newlines bool          // Convert CRLF line endings in output to LF
+	Executor_includes map[int][]string // Additional includes per executor index
+	Template_dir   string            // Template directory (default: <path>/templates)
+	Keep_dot       bool              // Also write the DOT source of rendered graphs
+	Launch_by_priority bool          // Launch executors in descending priority order
+	Maintainer     string            // Package maintainer name
+	Maintainer_email string          // Package maintainer email address
+	License        string            // Package license (e.g. Apache-2.0)
+	Version        string            // Package version (e.g. 0.1.0)
+	Require_dag    bool              // Reject chain graphs containing cycles
+	Executor_filter func(int, app.Executor) bool // Selects executors to generate (by index)
+	Filesystem     FileSystem        // Filesystem to write to (default: OS)
+	Executor_headers bool            // Generate a header per executor
+	Description    string            // Package description
+	Exec_packages  []string          // Additional run-time dependencies
+	Test_packages  []string          // Test dependencies
+	Buildtool_packages []string      // Build tool dependencies (default: ament_cmake)
+	Warn           func(string)      // Receives non-fatal warnings, one at a time (if set)
+	Check_includes bool              // Warn about local includes of missing headers
+	Lifecycle      bool              // Launch executors as lifecycle nodes
+	Trailing_newline bool            // End generated files with exactly one newline
+	Skip_identical_copies bool       // Do not rewrite byte-identical copied files
+	Package_includes bool            // Rewrite includes of copied headers to <name>/<header>
+	On_dir_created func(string) error // Called per created directory (error aborts)
+	Keep_plain     bool              // Also write the dot plain layout of rendered graphs
+	Run_linters    bool              // Run the linter on the generated package (output to Warn)
+	Linter_command []string          // Linter and arguments (default: ament_cpplint)
+	Chain_graph_name string          // Chain graph filename, sans extension (default: graph)
+	Application_graph_name string    // Application graph filename (default: application)
+	Preserve_symlinks bool           // Recreate copied symbolic links (default: copy target)
+	Reject_empty_copies bool         // Fail when a file to copy is empty
+	Chain_directories bool           // Place executor sources in src/chain_<k>/ (first chain)
+	Concurrency    int               // Bound on parallel generation tasks (default: 1; see FileSystem)
+	Package_script bool              // Emit a build script (build.sh) in the package root
+	Warning_flags  []string          // Compiler warning flags (e.g. -Wall, -Werror)
+	Graph_renderer GraphRenderer     // Renders the graphs (default: dot with graph.dt, application.dt)
+	Target_machine elf.Machine       // Machine copied libraries must target (EM_NONE: any)
+	Flat_includes  bool              // Place headers in include/ (default: include/<name>/)
+	Template_extension string        // Extension of all templates (default: tmpl; dt for graphs)
+	Warn_disconnected bool           // Warn about disconnected nodes left out of graphs
+	Png_optimizer  []string          // Optimizer run on images (e.g. optipng -quiet)
+	Derive_packages bool             // Add packages of the message type and includes
+	Build_hook     func(*Build) error // Adjusts the build before rendering (error aborts)
+	Watch_log      func(string)      // Receives messages of WatchAndGenerate (if set)
+	Priorities_report bool           // Write a table of node priorities (assets/priorities.md)
+	Filter_arity   map[int]int       // Synchronized filter inputs per executor index (default: 1)
+	Validate       func(string) error // Checks the generated package directory (error aborts)
+	Sort_includes  bool              // Sort includes (system first, then local)
+	Node_map       bool              // Write node to executor mapping (assets/node_map.csv)
+	Delimiters     [2]string         // Template action delimiters (empty: "{{" and "}}")
 }
 
 type Graphdata struct {
@@ -62,6 +197,101 @@ type Build struct {
 	Sources        []string          // Source files to compile with executables
 	Libraries      []string          // Libraries to link with executables
 	Executors      []ROS_Executor    // ROS executable structures
+	Ros_distro     string            // ROS distribution to build against
+	Cpp_standard   int               // C++ standard to compile with (0: default)
+	Compile_definitions []string     // Preprocessor definitions for executables
+	Source_extension string          // Extension of generated executor sources
+	Maintainer     string            // Package maintainer name
+	Maintainer_email string          // Package maintainer email address
+	License        string            // Package license
+	Version        string            // Package version
+	Description    string            // Package description
+	Build_depends  []string          // Build dependencies
+	Exec_depends   []string          // Run-time dependencies
+	Test_depends   []string          // Test dependencies
+	Buildtool_depends []string       // Build tool dependencies
+	Lifecycle      bool              // Launch executors as lifecycle nodes
+	Warning_flags  []string          // Compiler warning flags (target_compile_options)
+	Include_dir    string            // Header directory, relative to the package directory
+}
+
+/*
+ *******************************************************************************
+ *                          Private Type Definitions                           *
+ *******************************************************************************
+*/
+
+type planned_file struct {
+	data           interface{}       // Data to render the template with
+	template       string            // Template filename
+	path           string            // Output path, relative to the output directory
+	begin, end     string            // Markers of the generated region (if merging)
+	xml            bool              // Whether the region belongs inside the XML root element
+	executable     bool              // Whether to make the output executable
+	optional       bool              // Whether to skip the file if the template is absent
+}
+
+type planned_report struct {
+	path           string            // Output path, relative to the output directory
+	content        string            // Report content
+}
+
+type planned_copy struct {
+	paths          []string          // Paths of the files to copy
+	dir            string            // Destination, relative to the output directory
+	description    string            // Description of the copied files
+}
+
+/*
+ *******************************************************************************
+ *                         Filesystem Type Definitions                         *
+ *******************************************************************************
+*/
+
+// Filesystem used for all writes of GenerateApplication (inputs are read from the OS).
+// With a Concurrency above one, its methods are called from several goroutines
+type FileSystem interface {
+	Mkdir(path string, perm os.FileMode) error
+	Create(path string) (io.WriteCloser, error)
+	Open(path string) (io.ReadCloser, error)
+	Stat(path string) (os.FileInfo, error)
+	Rename(from, to string) error
+	RemoveAll(path string) error
+}
+
+// Filesystem backed by the operating system
+type os_filesystem struct{}
+
+func (os_filesystem) Mkdir (path string, perm os.FileMode) error {
+	return os.Mkdir(path, perm)
+}
+
+func (os_filesystem) Create (path string) (io.WriteCloser, error) {
+	return os.Create(path)
+}
+
+func (os_filesystem) Open (path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (os_filesystem) Stat (path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (os_filesystem) Rename (from, to string) error {
+	return os.Rename(from, to)
+}
+
+func (os_filesystem) RemoveAll (path string) error {
+	return os.RemoveAll(path)
+}
+
+func (os_filesystem) Chmod (path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func (os_filesystem) Symlink (target, path string) error {
+	return os.Symlink(target, path)
 }
 
 /*
@@ -70,11 +300,48 @@ type Build struct {
  *******************************************************************************
 */
 
+type Edge_key struct {
+	From      int                    // Source node
+	To        int                    // Destination node
+	Tag       int                    // Edge tag
+	Num       int                    // Edge number
+}
+
+type Graphstyle struct {
+	Sync_label     string            // Format of SYNC node labels (args: node, prio)
+	Sync_fill      string            // Fill color of SYNC nodes
+	Annotations    map[Edge_key]string // Free-text appended to edge labels
+	Rank_chains    bool              // Place the nodes of each chain on the same rank
+	Priority_border func(int) (float64, string) // Maps priority to border width and color
+	Critical_path  bool              // Highlight the longest-WCET path
+	Critical_color string            // Color of the critical path (default: red)
+	Wcet_overrides map[int]int64     // WCETs (us) replacing those of the graph data
+	Html_labels    bool              // Give nodes HTML-like (table) labels
+	Chain_palette  []string          // Fill colors of chain nodes, cycled by chain
+	Subgraph       bool              // Only render nodes reachable from Subgraph_root
+	Subgraph_root  int               // Root node of the rendered subgraph
+	Arrowhead      func(ops.Edge) string // Maps edges to arrowhead styles (e.g. none)
+	Order_chains   bool              // Order chain nodes by execution (with hint edges)
+	Max_nodes      int               // Refuse to render more nodes (0: default limit)
+	Max_edges      int               // Refuse to render more edges (0: default limit)
+	Label_edge     func(Edge_key) bool // Selects the edges that are labeled (default: all)
+	Edge_color     func(ops.Edge) string // Overrides edge colors when non-empty
+	Cluster_chains bool              // Draw the nodes of each chain in a cluster
+	Cluster_style  func(int) (string, string, string) // Maps chain to label, color, bgcolor
+	Title          bool              // Title graphs with the application name
+	Caption        string            // Line added below the title (e.g. a date)
+	Chain_labels   bool              // Name chain nodes with chain and position (N5 [c2:3])
+	Undirected     bool              // Render undirected, collapsing reciprocal edges
+	Tooltips       bool              // Give nodes tooltips with timing and edges (SVG)
+}
+
 type Link struct {
 	From      int                    // Source node
 	To        int                    // Destination node
 	Color     string                 // Link color
 	Label     string                 // Link label
+	Arrowhead string                 // Arrowhead style (empty: default)
+	Style     string                 // Link style (e.g. invis for ordering hints)
 }
 
 type Node struct {
@@ -83,16 +350,40 @@ type Node struct {
 	Style     string                 // Border style
 	Fill      string                 // Color indicating fill of the node
 	Shape     string                 // Shape of the node
+	PenWidth  float64                // Width of the node border
+	BorderColor string               // Color of the node border
+	HTMLLabel string                 // HTML-like label (replaces Label if set)
+	Tooltip   string                 // Tooltip text (SVG title; empty: none)
+}
+
+type Cluster struct {
+	Index     int                    // Chain index
+	Nodes     []int                  // IDs of the nodes in the cluster
+	Label     string                 // Cluster label
+	Color     string                 // Color of the cluster border
+	BGColor   string                 // Background color of the cluster
 }
 
 type Graphviz_graph struct {
 	Nodes     []Node                 // Nested clusters
 	Links     []Link                 // Slice of links
+	Ranks     [][]int                // Groups of node IDs sharing a rank
+	Clusters  []Cluster              // Chain clusters (subgraph cluster_<index>)
+	Title     string                 // Graph title (label, top located; empty: none)
+	Disconnected []int               // IDs of disconnected nodes left out
+	Undirected bool                  // Render as an undirected graph (graph, --)
 }
 
 type Graphviz_application struct {
 	App       *app.Application       // Application structure
 	Links     []Link                 // Slice of links
+	Title     string                 // Graph title (label, top located; empty: none)
+	Undirected bool                  // Render as an undirected graph (graph, --)
+}
+
+type DotInfo struct {
+	Version   string                 // Version string reported by dot
+	Formats   []string               // Output formats supported by dot
 }
 
 /*
@@ -101,64 +392,80 @@ type Graphviz_application struct {
  *******************************************************************************
 */
 
-// Generates a buffer from a template at 'path', which is fed to the given command as stdin
-func GenerateWithCommand (path, command string, args []string, 
-	data interface{}) error {
+// Generates a buffer from a template at 'path', which is fed to the given command as stdin.
+// The template is parsed with the given action delimiters (optional; see ParseTemplate)
+func GenerateWithCommand (path, command string, args []string, data interface{}, 
+	delimiters ...[2]string) error {
 	var err error = nil
-	var template_buffer []byte = []byte{}
 	var t *template.Template = nil
 
 	// Check: command exists
-	_, err = exec.LookPath(command)
+	_, err = look_path(command)
 	if nil != err {
-		return errors.New("Cannot find command \"" + command + "\": " + err.Error())
+		return fmt.Errorf("%w: \"%s\": %s", ErrCommandNotFound, command, err.Error())
 	}
 
-	// Check: valid data
-	if nil == data {
-		return errors.New("bad input: null pointer")
+	// Read and parse the template file
+	t, err = parse_template(path, optional_delimiters(delimiters))
+	if nil != err {
+		return err
 	}
 
-	// Read in the template file
-	template_buffer, err = ioutil.ReadFile(path)
-	if nil != err || template_buffer == nil {
-		return errors.New("Unable to read template \"" + path + "\": " + err.Error())
-	}
+	return ExecuteWithCommand(t, command, args, data)
+}
+
+// Generates a buffer from a pre-parsed template, which is fed to the given command
+// as stdin
+func ExecuteWithCommand (t *template.Template, command string, args []string, 
+	data interface{}) error {
+	var err error = nil
 
-	// Convert file to template
-	t, err = template.New("Unnamed").Parse(string(template_buffer))
+	// Check: command exists
+	_, err = look_path(command)
 	if nil != err {
-		return errors.New("Template parse error: " + err.Error())
+		return fmt.Errorf("%w: \"%s\": %s", ErrCommandNotFound, command, err.Error())
+	}
+
+	// Check: valid input
+	if nil == t || nil == data {
+		return errors.New("bad input: null pointer")
 	}
 
 	// Build command to run (configure it to read from a pipe)
-	cmd := exec.Command(command, args...)
+	var output bytes.Buffer
+	cmd := exec_command(command, args...)
 	r, w := io.Pipe()
-	cmd.Stdin = r
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = r, &output, &output
 
-	// Run the command in a goroutine
-	// TODO: Error check here
+	// Run the command in a goroutine (closing the reader unblocks the writer on exit)
+	done := make(chan error, 1)
 	go func() {
-		cmd.Run()
+		err := cmd.Run()
 		r.Close()
+		done <- err
 	}()
 
-	// Execute template into buffered writer
+	// Execute template into the pipe, then wait for the command
 	err = t.Execute(w, data)
-	defer w.Close()
-	if nil != err {
+	w.Close()
+	run_err := <-done
+	if nil != err && !errors.Is(err, io.ErrClosedPipe) {
 		return errors.New("Exception executing template: " + err.Error())
 	}
+	if nil != run_err {
+		return fmt.Errorf("%w: \"%s\": %s: %s", ErrCommandFailed, command, run_err.Error(), 
+			strings.TrimSpace(output.String()))
+	}
 
 	return nil
 }
 
-// Generates a file given a data structure, path to template, and output filename
-func GenerateTemplate (data interface{}, in_path, out_path string) error {
+// Generates a file given a data structure, path to template, and output filename.
+// The template is parsed with the given action delimiters (optional; see ParseTemplate)
+func GenerateTemplate (data interface{}, in_path, out_path string, 
+	delimiters ...[2]string) error {
 	var t *template.Template = nil
 	var err error = nil
-	var out_file *os.File = nil
-	var template_file []byte = []byte{}
 
 	// check: valid input
 	if nil == data {
@@ -169,30 +476,34 @@ func GenerateTemplate (data interface{}, in_path, out_path string) error {
 		return errors.New("input file (template) cannot be same as output file")
 	}
 
-	// Create the output file
-	out_file, err = os.Create(out_path)
+	// Read and parse the template file
+	t, err = parse_template(in_path, optional_delimiters(delimiters))
 	if nil != err {
-		return errors.New("unable to create output file (" + out_path + "): " + err.Error())
+		return err
 	}
-	defer out_file.Close()
 
-	// Open the template file
-	template_file, err = ioutil.ReadFile(in_path)
-	if nil != err {
-		return errors.New("unable to read input file (" + in_path + "): " + err.Error())
-	}
-	if template_file == nil {
-		panic(errors.New("Nil pointer to read file"))
+	return ExecuteTemplate(t, data, out_path)
+}
+
+// Generates a file given a pre-parsed template, data structure, and output filename
+func ExecuteTemplate (t *template.Template, data interface{}, out_path string) error {
+	var err error = nil
+	var out_file *os.File = nil
+
+	// check: valid input
+	if nil == t || nil == data {
+		return errors.New("bad argument: null pointer")
 	}
 
-	t, err = template.New("Unnamed").Parse(string(template_file))
+	// Create the output file
+	out_file, err = os.Create(out_path)
 	if nil != err {
-		return errors.New("unable to parse the template: " + err.Error())
+		return errors.New("unable to create output file (" + out_path + "): " + err.Error())
 	}
+	defer out_file.Close()
 
 	// Create buffered writer
 	writer := bufio.NewWriter(out_file)
-	defer writer.Flush()
 
 	// Execute template
 	err = t.Execute(writer, data)
@@ -200,256 +511,2622 @@ func GenerateTemplate (data interface{}, in_path, out_path string) error {
 		return errors.New("error executing template: " + err.Error())
 	}
 
+	// Flush buffered output
+	err = writer.Flush()
+	if nil != err {
+		return errors.New("unable to write output file (" + out_path + "): " + err.Error())
+	}
+
 	return nil
 }
 
-func GenerateApplication (a *app.Application, path string, meta Metadata, 
-	graph_data Graphdata) error {
-	var err error = nil
+// Renders a template at 'path' with the given data, and returns the output. The 
+// template is parsed with the given action delimiters (optional; see ParseTemplate)
+func GenerateString (data interface{}, path string, delimiters ...[2]string) (string, 
+	error) {
+	return generate_string(data, path, optional_delimiters(delimiters))
+}
 
-	// Closure: Attempts to make all given directories
-	make_directories := func (directories []string) error {
-		for _, dir := range directories {
-			err := os.Mkdir(dir, 0777)
-			if nil != err {
-				return errors.New("Cannot make dir (" + dir + "): " + err.Error())
-			}
-		}
-		return nil
+// Renders a template at 'path' with the given data into the given writer. The 
+// template is parsed with the given action delimiters (optional; see ParseTemplate)
+func GenerateTemplateTo (data interface{}, path string, w io.Writer, 
+	delimiters ...[2]string) error {
+	return generate_template_to(data, path, optional_delimiters(delimiters), w)
+}
+
+// Reads and parses the template file at 'path' with the given action delimiters
+// (empty strings select "{{" and "}}"), for use with ExecuteTemplate or 
+// ExecuteWithCommand
+func ParseTemplate (path string, delimiters [2]string) (*template.Template, error) {
+	return parse_template(path, delimiters)
+}
+
+// Returns the (sorted) field paths referenced by the template at 'path' (parsed 
+// with the optional delimiters), relative to the data the template is executed 
+// with. Fields inside 'range' are reported below the ranged path with '[]' (e.g.
+// ".Executors[].Source"), fields inside 'with' below the path it selects, and 
+// fields of invoked templates relative to the data passed to them. Fields whose 
+// context cannot be determined (e.g. of variables other than '$') are not reported
+func TemplateFields (path string, delimiters ...[2]string) ([]string, error) {
+	fields, seen := []string{}, map[string]bool{}
+
+	// Read and parse the template file
+	t, err := parse_template(path, optional_delimiters(delimiters))
+	if nil != err {
+		return []string{}, err
 	}
 
-	// Check: input
-	if nil == a {
-		return errors.New("bad argument: null pointer")
+	// Collect fields from the root template (following invoked templates)
+	if nil == t.Tree || nil == t.Tree.Root {
+		return fields, nil
 	}
+	collect_template_fields(t, t.Tree.Root, "", true, map[string]bool{}, 
+		func (field string) {
+			if !seen[field] {
+				seen[field] = true
+				fields = append(fields, field)
+			}
+		})
+	sort.Strings(fields)
+
+	return fields, nil
+}
 
-	// Strip possible forward-slash from path
-	if len(path) > 1 && strings.HasSuffix(path, "/") {
-		path = path[:len(path)-1]
+// Creates the template structure of the executor at the given index from the 
+// metadata (including per-executor overrides). Fields derived from the graph 
+// (Chains, Node_wcet_map, Node_prio_map, Wcet_us) are left empty
+func NewROSExecutor (meta Metadata, e app.Executor, index int) ROS_Executor {
+	source_extension := meta.Source_extension
+	if source_extension == "" {
+		source_extension = default_source_extension
+	}
+	includes := append([]string{}, meta.Includes...)
+	if nil != meta.Include_resolver {
+		includes = append(includes, meta.Include_resolver(meta.MsgType)...)
+	}
+	ros_exec := ROS_Executor{
+		Includes:      unique_strings(append(includes, meta.Executor_includes[index]...)),
+		MsgType:       meta.MsgType,
+		FilterPolicy:  meta.FilterPolicy,
+		PPE:           meta.PPE,
+		PPE_levels:    meta.PPE_levels,
+		Executor:      e,
+		Duration_us:   meta.Duration_us,
+		Node_wcet_map: map[int]int64{},
+		Node_prio_map: map[int]int{},
+		Source:        fmt.Sprintf("executor_%d.%s", index, source_extension),
+		Index:         index,
+		Filter_arity:  default_filter_arity,
+	}
+	if arity, ok := meta.Filter_arity[index]; ok {
+		ros_exec.Filter_arity = arity
 	}
+	if meta.Executor_headers {
+		ros_exec.Header = fmt.Sprintf("executor_%d.hpp", index)
+	}
+	return ros_exec
+}
 
-	// Prepare directories
-	root_dir := path + "/" + a.Name
-	src_dir, include_dir_1 := root_dir + "/src", root_dir + "/include"
-	include_dir_2 := include_dir_1 + "/" + a.Name
-	lib_dir, launch_dir := root_dir + "/lib", root_dir + "/launch"
-	assets_dir := root_dir + "/assets"
+// Renders all outputs of an application into memory, keyed by their path relative
+// to the output directory. Graphs are included as DOT source instead of images
+func BuildApplicationTree (a *app.Application, meta Metadata, 
+	graph_data Graphdata) (map[string][]byte, error) {
+	tree := map[string][]byte{}
 
-	// Create directories
-	ds := []string{root_dir, src_dir, include_dir_1, include_dir_2, lib_dir, 
-		launch_dir, assets_dir}
-	err = make_directories(ds)
+	// Render files and reports
+	outputs, err := render_application(a, meta, graph_data)
 	if nil != err {
-		return err
+		return nil, err
+	}
+	for path, output := range outputs {
+		tree[path] = []byte(output)
 	}
 
-	// Generate source files
-	executors := []ROS_Executor{}
-	for i, exec := range a.Executors {
-		ros_exec_name := fmt.Sprintf("executor_%d.cpp", i)
-		ros_exec := ROS_Executor{
-			Includes:     meta.Includes,
-			MsgType:      meta.MsgType,
-			FilterPolicy: meta.FilterPolicy,
-			PPE:          meta.PPE,
-			PPE_levels:   meta.PPE_levels,
-			Executor:     exec,
-			Duration_us:  meta.Duration_us,
-		}
-		executors = append(executors, ros_exec)
-
-		exec_template_file_name := fmt.Sprintf("executor_%d.tmpl", meta.Logging_mode)
-		err = GenerateTemplate(ros_exec, path + "/templates/" + exec_template_file_name, 
-			src_dir + "/" + ros_exec_name)
-		if nil != err {
-			return errors.New("Unable to generate source file: " + err.Error())
+	// Read in libraries, headers, and source files
+	for _, c := range application_copies(a, meta) {
+		for _, path := range c.paths {
+			filename, err := filename_from_path(path)
+			if nil != err {
+				return nil, err
+			}
+			content, err := ioutil.ReadFile(path)
+			if nil != err {
+				return nil, errors.New("Unable to read " + c.description + ": " + err.Error())
+			}
+			if meta.Reject_empty_copies && len(content) == 0 {
+				return nil, errors.New("Refusing to copy empty file: " + path)
+			}
+			tree[c.dir + "/" + filename] = content
 		}
 	}
 
-	// Update the metadata
-	sources, err := filenames_from_paths(meta.Sources)
+	// Render the graphs as DOT source
+	assets_dir := package_root(a, meta) + "/assets"
+	chain_name, application_name := graph_names(meta)
+	chain_dot, application_dot, err := dot_sources(a, meta, graph_data, meta.Template_dir)
 	if nil != err {
-		return err
+		return nil, err
 	}
-	libraries, err := filenames_from_paths(meta.Libraries)
+	tree[assets_dir + "/" + chain_name + ".dot"] = []byte(chain_dot)
+	tree[assets_dir + "/" + application_name + ".dot"] = []byte(application_dot)
+
+	return tree, nil
+}
+
+// Estimates the number of bytes generation writes: rendered templates, reports, 
+// and copied files. Rendered graph images are not included. Nothing is written
+func EstimateSize (a *app.Application, meta Metadata, graph_data Graphdata) (int64, error) {
+	var size int64 = 0
+
+	// Sum the rendered files and reports
+	outputs, err := render_application(a, meta, graph_data)
 	if nil != err {
-		return err
+		return 0, err
 	}
-	build := Build{
-		Name:      a.Name,
-		Packages:  meta.Packages,
-		Sources:   sources,
-		Libraries: libraries,
-		Executors: executors,
+	for _, output := range outputs {
+		size += int64(len(output))
 	}
 
-	// Generate makefile
-	err = GenerateTemplate(build, path + "/templates/CMakeLists.tmpl", root_dir + "/CMakeLists.txt")
-	if nil != err {
-		return errors.New("Unable to generate CMakeLists: " + err.Error())
+	// Sum the copied files
+	for _, c := range application_copies(a, meta) {
+		for _, path := range c.paths {
+			info, err := os.Stat(path)
+			if nil != err {
+				return 0, errors.New("Unable to locate " + c.description + ": " + err.Error())
+			}
+			size += info.Size()
+		}
 	}
 
-	// Generate package descriptor file
-	err = GenerateTemplate(build, path + "/templates/package.tmpl", root_dir + "/package.xml")
+	return size, nil
+}
+
+// Writes only the DOT sources of the chain and application graphs to 'out_dir',
+// without running dot. Templates are read from '<out_dir>/templates' unless 
+// configured otherwise
+func GenerateDOTFiles (a *app.Application, meta Metadata, graph_data Graphdata, 
+	out_dir string) error {
+
+	// Check: valid application
+	err := check_application(a, meta)
 	if nil != err {
-		return errors.New("Unable to generate package XML file: " + err.Error())
+		return err
+	}
+
+	// Check: valid path
+	if out_dir == "" {
+		return errors.New("bad argument: empty path")
+	}
+
+	// Templates are read from the given path unless configured otherwise
+	template_dir := meta.Template_dir
+	if template_dir == "" {
+		template_dir = out_dir + "/templates"
 	}
 
-	// Copy in libraries, headers, and source files
-	err = copy_files_to(meta.Libraries, lib_dir)
+	// Render and write the DOT sources
+	chain_dot, application_dot, err := dot_sources(a, meta, graph_data, template_dir)
 	if nil != err {
-		return errors.New("Unable to copy in libraries/header/src-files: " + err.Error())
+		return err
 	}
-	err = copy_files_to(meta.Headers, include_dir_2)
+	chain_name, application_name := graph_names(meta)
+	fs := filesystem(meta)
+	err = write_file(fs, out_dir + "/" + chain_name + ".dot", []byte(chain_dot))
 	if nil != err {
-		return errors.New("Unable to copy headers to include dir: " + err.Error())
+		return errors.New("Unable to write graph dot file: " + err.Error())
 	}
-	err = copy_files_to(meta.Sources, src_dir)
+	err = write_file(fs, out_dir + "/" + application_name + ".dot", []byte(application_dot))
 	if nil != err {
-		return errors.New("Unable to copy source files to src dir: " + err.Error())
+		return errors.New("Unable to write application dot file: " + err.Error())
 	}
 
-	// Generate the launch file
-	err = GenerateTemplate(build, path + "/templates/launch.tmpl", 
-		launch_dir + "/" + build.Name + "_launch.py")
+	return nil
+}
+
+// Renders only the launch file of a build from the template at 'template_path'
+func GenerateLaunchFile (build Build, template_path, out_path string) error {
+	err := GenerateTemplate(build, template_path, out_path)
 	if nil != err {
 		return errors.New("Unable to generate launch file: " + err.Error())
 	}
+	return nil
+}
 
-	// Generate the chains graph
-	graphviz_graph, err := graph_to_graphviz(graph_data)
-	if nil != err {
-		return errors.New("Unable to generate graphviz graph file: " + 
-			err.Error())
+// Renders all outputs of an application (see BuildApplicationTree) and writes each
+// to the writer returned by 'create' for its path. This allows generation into any
+// backend, such as in-memory buffers
+func GenerateApplicationTo (a *app.Application, meta Metadata, graph_data Graphdata, 
+	create func(string) (io.WriteCloser, error)) error {
+
+	// Check: valid input
+	if nil == create {
+		return errors.New("bad argument: null pointer")
 	}
-	err = GenerateWithCommand(path + "/templates/graph.dt", "dot", 
-		[]string{"-Tpng", "-o", assets_dir + "/graph.png"}, graphviz_graph)
+
+	// Render the outputs
+	tree, err := BuildApplicationTree(a, meta, graph_data)
 	if nil != err {
-		return errors.New("Unable to generate graph dot file: " +
-			err.Error())
+		return err
 	}
 
-	// Generate the application graph
-	graphviz_application, err := application_to_graphviz(a, graph_data.Graph)
-	if nil != err {
-		return errors.New("Unable to generate graphviz application file: " + 
-			err.Error())
+	// Write the outputs (in a stable order)
+	paths := []string{}
+	for path := range tree {
+		paths = append(paths, path)
 	}
-	err = GenerateWithCommand(path + "/templates/application.dt", "dot", 
-		[]string{"-Tpng", "-o", assets_dir + "/application.png"}, 
-		graphviz_application)
-	if nil != err {
-		return errors.New("Unable to generate application dot file: " + 
-			err.Error())
+	sort.Strings(paths)
+	for _, path := range paths {
+		w, err := create(path)
+		if nil != err {
+			return errors.New("Unable to create " + path + ": " + err.Error())
+		}
+		_, err = w.Write(tree[path])
+		if nil == err {
+			err = w.Close()
+		} else {
+			w.Close()
+		}
+		if nil != err {
+			return errors.New("Unable to write " + path + ": " + err.Error())
+		}
 	}
 
 	return nil
 }
 
-/*
- *******************************************************************************
- *                         Private Graphviz Functions                          *
- *******************************************************************************
-*/
+func GenerateApplication (a *app.Application, path string, meta Metadata, 
+	graph_data Graphdata) error {
+	return generate_application(a, path, meta, graph_data, false)
+}
 
-// Converts internal graph representation to graphviz application data structure
-func application_to_graphviz (a *app.Application, g *graph.Graph) (Graphviz_application, error) {
-	links := []Link{}
+// Reports the version and supported output formats of the installed dot command
+func CheckDot () (DotInfo, error) {
+	var info DotInfo = DotInfo{}
 
-	// Create all links
-	for i := 0; i < g.Len(); i++ {
-		for j := 0; j < g.Len(); j++ {
-			edges := ops.EdgesAt(i, j, g)
-			for _, e := range edges {
-				label := fmt.Sprintf("%d.%d", e.Tag, e.Num)
-				links = append(links, Link{From: i, To: j, Color: e.Color, Label: label})
-			}
-		}
+	// Check: command exists
+	_, err := look_path("dot")
+	if nil != err {
+		return info, fmt.Errorf("%w: \"dot\": %s", ErrCommandNotFound, err.Error())
+	}
+
+	// Obtain the version (dot prints it to stderr)
+	output, err := exec_command("dot", "-V").CombinedOutput()
+	if nil != err {
+		return info, errors.New("Unable to query dot version: " + err.Error())
 	}
+	info.Version = strings.TrimSpace(string(output))
+
+	// Obtain the formats (dot exits with an error, listing them after a marker)
+	output, _ = exec_command("dot", "-T?").CombinedOutput()
+	marker := "Use one of:"
+	index := strings.Index(string(output), marker)
+	if index < 0 {
+		return info, errors.New("Unable to parse dot formats: " + string(output))
+	}
+	info.Formats = strings.Fields(string(output)[index + len(marker):])
 
-	return Graphviz_application{App: a, Links: links}, nil
+	return info, nil
 }
 
-// Converts internal graph representation to graphviz data structure
-func graph_to_graphviz (graph_data Graphdata) (Graphviz_graph, error) {
-	nodes := []Node{}
-	links := []Link{}
+// Returns true if dot reported support for the given output format
+func DotSupports (info DotInfo, format string) bool {
+	for _, f := range info.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
 
-	// Closure: Returns true if the given chain has a length of one
-	length_one_chain := func (row int) bool {
-		return graph_data.Chains[ops.ChainForRow(row, graph_data.Chains)] == 1
+// Returns the total WCET (us) of the nodes hosted by an executor
+func ExecutorWCET (e app.Executor, graph_data Graphdata) int64 {
+	var total int64 = 0
+	for _, id := range executor_nodes(e) {
+		total += graph_data.Node_wcet_map[id]
 	}
+	return total
+}
 
-	// Obtain the number of nodes that belong to chains
-	n_chain_nodes := ops.NodeCount(graph_data.Chains)
+// Returns warnings for metadata settings that have no effect given the others
+func MetadataWarnings (meta Metadata) []string {
+	warnings := []string{}
 
-	// Create all nodes (but only if connected or chain has length 1)
-	for i := 0; i < graph_data.Graph.Len(); i++ {
-		if !ops.Disconnected(i, graph_data.Graph) || length_one_chain(i) {
+	if meta.PPE == 0 && meta.PPE_levels != 0 {
+		warnings = append(warnings, fmt.Sprintf("PPE_levels (%d) is ignored when PPE is disabled",
+			meta.PPE_levels))
+	}
+	if !meta.Workspace && meta.Workspace_script {
+		warnings = append(warnings, "Workspace_script is ignored when Workspace is disabled")
+	}
 
-			// It's a chain node if below the original graph node count
-			if i < n_chain_nodes {
-				label := fmt.Sprintf("N%d\n(wcet=%d us)\nprio=%d", i, graph_data.Node_wcet_map[i], 
-					graph_data.Node_prio_map[i])
-				nodes = append(nodes, 
-					Node{Id: i, Label: label, Style: "filled", Fill: "#FFFFFF", Shape: "circle"})
-			} else {
-				label := fmt.Sprintf("N%d\n(SYNC)\nprio=%d", i, graph_data.Node_prio_map[i])
-				nodes = append(nodes, 
-					Node{Id: i, Label: label, Style: "filled", Fill: "#FFE74C", Shape: "diamond"})
-			}
-		
+	// Headers are copied in, but only used if some include names them
+	includes := append([]string{}, meta.Includes...)
+	if nil != meta.Include_resolver {
+		includes = append(includes, meta.Include_resolver(meta.MsgType)...)
+	}
+	for _, executor_includes := range meta.Executor_includes {
+		includes = append(includes, executor_includes...)
+	}
+	for _, header := range meta.Headers {
+		if !header_included(filepath.Base(header), includes) {
+			warnings = append(warnings, "Header " + header + " is copied, but not included " + 
+				"(Includes, Executor_includes)")
 		}
 	}
 
-	// Create all links
-	for i := 0; i < graph_data.Graph.Len(); i++ {
-		for j := 0; j < graph_data.Graph.Len(); j++ {
-			edges := ops.EdgesAt(i, j, graph_data.Graph)
-			for _, e := range edges {
-				label := fmt.Sprintf("%d.%d", e.Tag, e.Num)
-				links = append(links, Link{From: i, To: j, Color: e.Color, Label: label})
-			}
-		}
+	// Options that depend on another option
+	style := meta.Graph_style
+	if !style.Title && style.Caption != "" {
+		warnings = append(warnings, "Caption is ignored when Title is disabled")
+	}
+	if !style.Critical_path && style.Critical_color != "" {
+		warnings = append(warnings, "Critical_color is ignored when Critical_path is disabled")
+	}
+	if !style.Subgraph && style.Subgraph_root != 0 {
+		warnings = append(warnings, fmt.Sprintf("Subgraph_root (%d) is ignored when Subgraph " + 
+			"is disabled", style.Subgraph_root))
+	}
+	if !meta.Run_linters && len(meta.Linter_command) > 0 {
+		warnings = append(warnings, "Linter_command is ignored when Run_linters is disabled")
+	}
+	if meta.Run_linters && nil == meta.Warn {
+		warnings = append(warnings, "Run_linters output is dropped when Warn is unset")
 	}
 
-	return Graphviz_graph{Nodes: nodes, Links: links}, nil
+	// Options of dot rendering that other renderers do not apply
+	if _, ok := meta.Graph_renderer.(Graphviz_renderer); !ok && nil != meta.Graph_renderer {
+		if len(meta.Png_optimizer) > 0 {
+			warnings = append(warnings, "Png_optimizer is ignored when Graph_renderer is " + 
+				"not a Graphviz_renderer")
+		}
+		if meta.Keep_dot {
+			warnings = append(warnings, "Keep_dot is ignored when Graph_renderer is not a " + 
+				"Graphviz_renderer")
+		}
+		if meta.Keep_plain {
+			warnings = append(warnings, "Keep_plain is ignored when Graph_renderer is not a " + 
+				"Graphviz_renderer")
+		}
+	}
+	return warnings
 }
 
+// Checks that the edges among chain nodes form a DAG, naming a cycle if not
+func ValidateDAG (graph_data Graphdata) error {
 
-/*
- *******************************************************************************
- *                          Private Support Functions                          *
- *******************************************************************************
+	// Check: valid input
+	if nil == graph_data.Graph {
+		return errors.New("bad argument: null pointer")
+	}
+
+	// Depth-first search over chain nodes, tracking the nodes on the stack
+	n_chain_nodes := ops.NodeCount(graph_data.Chains)
+	adjacent := adjacency(graph_data.Graph)
+	state, stack := map[int]int{}, []int{}
+	var visit func (u int) []int
+	visit = func (u int) []int {
+		state[u] = 1
+		stack = append(stack, u)
+		for _, v := range adjacent[u] {
+			if v >= n_chain_nodes {
+				continue
+			}
+			if state[v] == 1 {
+				for k := range stack {
+					if stack[k] == v {
+						return append(append([]int{}, stack[k:]...), v)
+					}
+				}
+			}
+			if state[v] == 0 {
+				if cycle := visit(v); nil != cycle {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack) - 1]
+		state[u] = 2
+		return nil
+	}
+
+	for u := 0; u < n_chain_nodes && u < graph_data.Graph.Len(); u++ {
+		if state[u] != 0 {
+			continue
+		}
+		if cycle := visit(u); nil != cycle {
+			names := []string{}
+			for _, id := range cycle {
+				names = append(names, fmt.Sprintf("N%d", id))
+			}
+			return errors.New("cycle among chain nodes: " + strings.Join(names, " -> "))
+		}
+	}
+	return nil
+}
+
+// Returns the path through the graph with the largest total WCET, and that total
+func CriticalPath (graph_data Graphdata) ([]int, int64, error) {
+
+	// Check: valid input
+	if nil == graph_data.Graph {
+		return []int{}, 0, errors.New("bad argument: null pointer")
+	}
+
+	// Order the nodes topologically (fails on cycles)
+	order, err := topological_order(graph_data.Graph)
+	if nil != err {
+		return []int{}, 0, err
+	}
+
+	// Compute the heaviest path ending at each node
+	adjacent := adjacency(graph_data.Graph)
+	total, previous := map[int]int64{}, map[int]int{}
+	for _, u := range order {
+		if _, ok := previous[u]; !ok {
+			previous[u], total[u] = -1, graph_data.Node_wcet_map[u]
+		}
+		for _, v := range adjacent[u] {
+			if _, ok := previous[v]; !ok || total[u] + graph_data.Node_wcet_map[v] > total[v] {
+				previous[v], total[v] = u, total[u] + graph_data.Node_wcet_map[v]
+			}
+		}
+	}
+
+	// Trace back from the heaviest endpoint
+	end := -1
+	for _, u := range order {
+		if end < 0 || total[u] > total[end] {
+			end = u
+		}
+	}
+	if end < 0 {
+		return []int{}, 0, nil
+	}
+	path := []int{}
+	for u := end; u >= 0; u = previous[u] {
+		path = append([]int{u}, path...)
+	}
+
+	return path, total[end], nil
+}
+
+// Combines graphviz graphs: nodes are merged by ID (first wins), links are concatenated
+func MergeGraphviz (gs ...Graphviz_graph) Graphviz_graph {
+	merged, seen := Graphviz_graph{Nodes: []Node{}, Links: []Link{}, Ranks: [][]int{}, 
+		Clusters: []Cluster{}}, map[int]bool{}
+	for _, g := range gs {
+		for _, n := range g.Nodes {
+			if !seen[n.Id] {
+				seen[n.Id] = true
+				merged.Nodes = append(merged.Nodes, n)
+			}
+		}
+		merged.Links = append(merged.Links, g.Links...)
+		merged.Ranks = append(merged.Ranks, g.Ranks...)
+		merged.Clusters = append(merged.Clusters, g.Clusters...)
+	}
+	return merged
+}
+
+// Checks that node IDs in a graphviz graph are unique, and that all links 
+// reference declared nodes
+func ValidateGraphviz (g Graphviz_graph) error {
+	declared := map[int]bool{}
+	for _, n := range g.Nodes {
+		if declared[n.Id] {
+			return fmt.Errorf("duplicate node ID %d", n.Id)
+		}
+		declared[n.Id] = true
+	}
+	return validate_links(g.Links, declared)
+}
+
+// Checks that all links in a graphviz application reference declared nodes
+func ValidateGraphvizApplication (g Graphviz_application) error {
+	declared := map[int]bool{}
+
+	// Check: valid input
+	if nil == g.App {
+		return errors.New("bad argument: null pointer")
+	}
+
+	for _, exec := range g.App.Executors {
+		for _, id := range executor_nodes(exec) {
+			declared[id] = true
+		}
+	}
+	return validate_links(g.Links, declared)
+}
+
+/*
+ *******************************************************************************
+ *                        Private Generation Functions                         *
+ *******************************************************************************
+*/
+
+// Generates an application into 'path'. When regenerating, existing directories
+// (created by an earlier generation) are reused
+func generate_application (a *app.Application, path string, meta Metadata, 
+	graph_data Graphdata, regenerate bool) error {
+	var err error = nil
+
+	fs := filesystem(meta)
+
+	// Closure: Attempts to make all given directories
+	make_directories := func (directories []string) error {
+		for _, dir := range directories {
+			err := fs.Mkdir(dir, 0777)
+			if nil != err && (meta.Merge_build_files || regenerate) && os.IsExist(err) {
+				continue
+			}
+			if nil != err {
+				return errors.New("Cannot make dir (" + dir + "): " + err.Error())
+			}
+			if nil != meta.On_dir_created {
+				err = meta.On_dir_created(dir)
+				if nil != err {
+					return errors.New("Directory hook failed (" + dir + "): " + err.Error())
+				}
+			}
+		}
+		return nil
+	}
+
+	// Check: valid application
+	err = check_application(a, meta)
+	if nil != err {
+		return err
+	}
+
+	// Check: libraries match the target machine (if configured)
+	err = check_libraries(meta)
+	if nil != err {
+		return err
+	}
+
+	// Check: valid path
+	if path == "" {
+		return errors.New("bad argument: empty path")
+	}
+
+	// Normalize the path (resolves "." and strips trailing separators)
+	abs_path, err := filepath.Abs(path)
+	if nil != err {
+		return errors.New("Cannot resolve path (" + path + "): " + err.Error())
+	}
+	path = abs_path
+
+	// Templates are read from the given path unless configured otherwise
+	template_dir := meta.Template_dir
+	if template_dir == "" {
+		template_dir = path + "/templates"
+	}
+
+	// Assemble the build and plan the outputs
+	build, err := application_build(a, meta, graph_data)
+	if nil != err {
+		return err
+	}
+	files := available_files(application_files(a, meta, build), template_dir)
+	copies := application_copies(a, meta)
+	reports := application_reports(a, meta, build)
+
+	// Closure: Reports the start of a generation step (if requested)
+	current_step, total_steps := 0, len(files) + len(copies) + len(reports) + 2
+	if meta.Run_linters {
+		total_steps++
+	}
+	var progress_lock sync.Mutex
+	progress := func (step string) {
+		progress_lock.Lock()
+		defer progress_lock.Unlock()
+		current_step++
+		if nil != meta.Progress {
+			meta.Progress(step, current_step, total_steps)
+		}
+	}
+
+	// Nest the package in the source directory of a colcon workspace
+	if meta.Workspace {
+		err = fs.Mkdir(path + "/src", 0777)
+		if nil != err && !os.IsExist(err) {
+			return errors.New("Cannot make workspace dir (" + path + "/src): " + err.Error())
+		}
+		if nil == err && nil != meta.On_dir_created {
+			err = meta.On_dir_created(path + "/src")
+			if nil != err {
+				return errors.New("Directory hook failed (" + path + "/src): " + err.Error())
+			}
+		}
+	}
+
+	// Prepare directories
+	root_dir := path + "/" + package_root(a, meta)
+	src_dir, include_dir_1 := root_dir + "/src", root_dir + "/include"
+	include_dir_2 := root_dir + "/" + include_dir(a, meta)
+	lib_dir, launch_dir := root_dir + "/lib", root_dir + "/launch"
+	assets_dir := root_dir + "/assets"
+
+	// Create directories
+	ds := []string{root_dir, src_dir, include_dir_1, include_dir_2, lib_dir, 
+		launch_dir, assets_dir}
+	for _, exec := range build.Executors {
+		if dir := filepath.Dir(exec.Source); dir != "." {
+			ds = append(ds, src_dir + "/" + dir)
+		}
+	}
+	err = make_directories(unique_strings(ds))
+	if nil != err {
+		return err
+	}
+
+	// Tasks: Generate source, build, and launch files
+	tasks := []func() error{}
+	for _, f := range files {
+		f := f
+		tasks = append(tasks, func () error {
+			progress("Generating " + f.path)
+			var err error = nil
+			if f.begin != "" {
+				err = generate_region(f.data, template_dir + "/" + f.template, 
+					path + "/" + f.path, f.begin, f.end, f.xml, meta)
+			} else {
+				err = generate_file(f.data, template_dir + "/" + f.template, 
+					path + "/" + f.path, meta)
+			}
+			if nil == err && f.executable {
+				err = make_executable(fs, path + "/" + f.path)
+			}
+			if nil != err {
+				return errors.New("Unable to generate " + f.path + ": " + err.Error())
+			}
+			return nil
+		})
+	}
+
+	// Tasks: Copy in libraries, headers, and source files
+	for _, c := range copies {
+		c := c
+		tasks = append(tasks, func () error {
+			progress("Copying " + c.description)
+			err := copy_files_to(c.paths, path + "/" + c.dir, meta)
+			if nil != err {
+				return errors.New("Unable to copy " + c.description + ": " + err.Error())
+			}
+			return nil
+		})
+	}
+
+	// Tasks: Write reports
+	for _, r := range reports {
+		r := r
+		tasks = append(tasks, func () error {
+			progress("Writing " + r.path)
+			err := write_file(fs, path + "/" + r.path, []byte(r.content))
+			if nil != err {
+				return errors.New("Unable to write " + r.path + ": " + err.Error())
+			}
+			return nil
+		})
+	}
+
+	// Task: Generate the chains graph
+	chain_name, application_name := graph_names(meta)
+	renderer := graph_renderer(meta, template_dir)
+	tasks = append(tasks, func () error {
+		progress("Rendering chain graph")
+		graphviz_graph, err := chain_graph(a, graph_data, meta)
+		if nil != err {
+			return errors.New("Unable to generate graphviz graph file: " + 
+				err.Error())
+		}
+		err = render_with(renderer, graphviz_graph, assets_dir + "/" + chain_name, meta)
+		if nil != err {
+			return errors.New("Unable to generate graph dot file: " +
+				err.Error())
+		}
+		return nil
+	})
+
+	// Task: Generate the application graph (if the renderer supports it)
+	tasks = append(tasks, func () error {
+		progress("Rendering application graph")
+		if _, ok := renderer.(application_renderer); !ok {
+			return nil
+		}
+		graphviz_application, err := application_graph(a, graph_data, meta)
+		if nil != err {
+			return errors.New("Unable to generate graphviz application file: " + 
+				err.Error())
+		}
+		err = render_with(renderer, graphviz_application, assets_dir + "/" + 
+			application_name, meta)
+		if nil != err {
+			return errors.New("Unable to generate application dot file: " + 
+				err.Error())
+		}
+		return nil
+	})
+
+	// Run the tasks (serially, unless configured otherwise)
+	err = run_tasks(tasks, meta.Concurrency)
+	if nil != err {
+		return err
+	}
+
+	// Check local includes of sources against the package headers (if requested)
+	if meta.Check_includes {
+		sources, headers := []string{}, map[string]bool{}
+		for _, f := range files {
+			if is_source_file(f.path, build.Source_extension) {
+				sources = append(sources, path + "/" + f.path)
+			} else if is_header_file(f.path) {
+				headers[filepath.Base(f.path)] = true
+			}
+		}
+		for _, c := range copies {
+			for _, p := range c.paths {
+				if is_source_file(p, build.Source_extension) {
+					sources = append(sources, path + "/" + c.dir + "/" + filepath.Base(p))
+				} else if is_header_file(p) {
+					headers[filepath.Base(p)] = true
+				}
+			}
+		}
+		warnings, err := orphan_includes(fs, sources, headers, a.Name)
+		if nil != err {
+			return errors.New("Unable to check includes: " + err.Error())
+		}
+		for _, warning := range warnings {
+			warn(meta, warning)
+		}
+	}
+
+	// Lint the generated package (if requested)
+	if meta.Run_linters {
+		progress("Linting package")
+		output, err := run_linter(root_dir, meta)
+		if nil != err {
+			return errors.New("Unable to lint package: " + err.Error())
+		}
+		if output != "" {
+			warn(meta, "Linter output: " + output)
+		}
+	}
+
+	// Run the caller's checks on the generated package (if requested)
+	if nil != meta.Validate {
+		err = meta.Validate(root_dir)
+		if nil != err {
+			return errors.New("Validation of generated package failed: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Checks that an application can be generated with the given metadata
+func check_application (a *app.Application, meta Metadata) error {
+
+	// Check: input
+	if nil == a {
+		return errors.New("bad argument: null pointer")
+	}
+
+	// Check: at least one executor (unless explicitly allowed)
+	if len(a.Executors) == 0 && !meta.Allow_empty {
+		return errors.New("bad argument: application has no executors")
+	}
+
+	// Check: application name is usable as a directory name
+	if a.Name == "" || a.Name == "." || a.Name == ".." || strings.ContainsRune(a.Name, '/') {
+		return errors.New("bad argument: invalid application name \"" + a.Name + "\"")
+	}
+
+	// Check: per-executor overrides reference existing executors
+	overrides := map[string][]int{}
+	for index := range meta.Executor_includes {
+		overrides["Executor_includes"] = append(overrides["Executor_includes"], index)
+	}
+	for index := range meta.Filter_arity {
+		overrides["Filter_arity"] = append(overrides["Filter_arity"], index)
+	}
+	for _, name := range []string{"Executor_includes", "Filter_arity"} {
+		invalid := []int{}
+		for _, index := range overrides[name] {
+			if index < 0 || index >= len(a.Executors) {
+				invalid = append(invalid, index)
+			}
+		}
+		if len(invalid) > 0 {
+			sort.Ints(invalid)
+			return fmt.Errorf("bad argument: %s references executor indices %v " + 
+				"(application has %d executors)", name, invalid, len(a.Executors))
+		}
+	}
+
+	// Check: filters synchronize at least one input
+	indices := []int{}
+	for index, arity := range meta.Filter_arity {
+		if arity < 1 {
+			indices = append(indices, index)
+		}
+	}
+	if len(indices) > 0 {
+		sort.Ints(indices)
+		return fmt.Errorf("bad argument: Filter_arity of executor %d is %d (minimum: 1)", 
+			indices[0], meta.Filter_arity[indices[0]])
+	}
+
+	return nil
+}
+
+// Assembles the build (and its executors) for an application
+func application_build (a *app.Application, meta Metadata, graph_data Graphdata) (Build, error) {
+
+	// Prepare executors
+	source_extension := meta.Source_extension
+	if source_extension == "" {
+		source_extension = default_source_extension
+	}
+	executors := []ROS_Executor{}
+	for i, exec := range a.Executors {
+		if nil != meta.Executor_filter && !meta.Executor_filter(i, exec) {
+			continue
+		}
+		ros_exec := NewROSExecutor(meta, exec, i)
+		ros_exec.Includes = package_includes(a.Name, ros_exec.Includes, meta)
+		if meta.Sort_includes {
+			ros_exec.Includes = sort_includes(a.Name, ros_exec.Includes)
+		}
+		ros_exec.Chains = executor_chains(exec, graph_data)
+		if meta.Chain_directories && len(ros_exec.Chains) > 0 {
+			ros_exec.Source = fmt.Sprintf("chain_%d/%s", ros_exec.Chains[0], ros_exec.Source)
+		}
+		ros_exec.Wcet_us = ExecutorWCET(exec, graph_data)
+		for _, id := range executor_nodes(exec) {
+			ros_exec.Node_wcet_map[id] = graph_data.Node_wcet_map[id]
+			ros_exec.Node_prio_map[id] = graph_data.Node_prio_map[id]
+		}
+		executors = append(executors, ros_exec)
+	}
+
+	// Prepare the build
+	sources, err := filenames_from_paths(meta.Sources)
+	if nil != err {
+		return Build{}, err
+	}
+	libraries, err := filenames_from_paths(meta.Libraries)
+	if nil != err {
+		return Build{}, err
+	}
+	ros_distro := meta.Ros_distro
+	if ros_distro == "" {
+		ros_distro = default_ros_distro
+	}
+	buildtool_depends := meta.Buildtool_packages
+	if len(buildtool_depends) == 0 {
+		buildtool_depends = []string{default_buildtool}
+	}
+	packages := meta.Packages
+	if meta.Derive_packages {
+		packages = derive_packages(a, meta, executors)
+	}
+
+	// Slices are copied, so that the build hook cannot modify the metadata
+	build := Build{
+		Name:       a.Name,
+		Packages:   append([]string{}, packages...),
+		Sources:    sources,
+		Libraries:  libraries,
+		Executors:  executors,
+		Ros_distro: ros_distro,
+		Cpp_standard: meta.Cpp_standard,
+		Compile_definitions: append([]string{}, meta.Compile_definitions...),
+		Source_extension: source_extension,
+		Maintainer: meta.Maintainer,
+		Maintainer_email: meta.Maintainer_email,
+		License:    meta.License,
+		Version:    meta.Version,
+		Description: meta.Description,
+		Build_depends: append([]string{}, packages...),
+		Exec_depends: unique_strings(append(append([]string{}, packages...), 
+			meta.Exec_packages...)),
+		Test_depends: append([]string{}, meta.Test_packages...),
+		Buildtool_depends: append([]string{}, buildtool_depends...),
+		Lifecycle:  meta.Lifecycle,
+		Warning_flags: append([]string{}, meta.Warning_flags...),
+		Include_dir: include_dir(a, meta),
+	}
+
+	// Let the caller adjust the build before rendering (if requested)
+	if nil != meta.Build_hook {
+		err = meta.Build_hook(&build)
+		if nil != err {
+			return Build{}, errors.New("Build hook failed: " + err.Error())
+		}
+	}
+
+	return build, nil
+}
+
+// Returns the explicit packages, followed by those referenced by the message type
+// (e.g. std_msgs::msg::String) and by the executor includes. Only .hpp includes
+// with a directory are considered (e.g. std_msgs/msg/string.hpp), so that system 
+// headers such as sys/time.h are not mistaken for packages
+func derive_packages (a *app.Application, meta Metadata, executors []ROS_Executor) []string {
+	packages := append([]string{}, meta.Packages...)
+
+	// Message type
+	msg_type := strings.ReplaceAll(meta.MsgType, "::", "/")
+	if parts := strings.Split(msg_type, "/"); len(parts) > 1 && parts[0] != "" {
+		packages = append(packages, parts[0])
+	}
+
+	// Includes (excluding those of the package itself)
+	for _, exec := range executors {
+		for _, include := range exec.Includes {
+			_, path, _ := split_include(include)
+			parts := strings.Split(path, "/")
+			if len(parts) > 1 && parts[0] != "" && parts[0] != a.Name && 
+				strings.HasSuffix(path, ".hpp") {
+				packages = append(packages, parts[0])
+			}
+		}
+	}
+
+	return unique_strings(packages)
+}
+
+// Rewrites includes of copied headers to their location in the package, keeping 
+// their delimiters (if requested)
+func package_includes (name string, includes []string, meta Metadata) []string {
+	if !meta.Package_includes {
+		return includes
+	}
+	headers, rewritten, prefix := map[string]bool{}, []string{}, name + "/"
+	if meta.Flat_includes {
+		prefix = ""
+	}
+	for _, header := range meta.Headers {
+		headers[filepath.Base(header)] = true
+	}
+	for _, include := range includes {
+		open, path, close := split_include(include)
+		if headers[filepath.Base(path)] {
+			include = open + prefix + filepath.Base(path) + close
+		}
+		rewritten = append(rewritten, include)
+	}
+	return unique_strings(rewritten)
+}
+
+// Returns the package directory, relative to the output directory
+func package_root (a *app.Application, meta Metadata) string {
+	if meta.Workspace {
+		return "src/" + a.Name
+	}
+	return a.Name
+}
+
+// Replaces the extension of a template filename with the configured one (if any)
+func template_name (filename string, meta Metadata) string {
+	if meta.Template_extension == "" {
+		return filename
+	}
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + "." + 
+		strings.TrimPrefix(meta.Template_extension, ".")
+}
+
+// Sorts includes alphabetically: system includes first, then local includes (quoted,
+// or of headers in the package)
+func sort_includes (name string, includes []string) []string {
+	sorted := append([]string{}, includes...)
+	local := func (include string) bool {
+		open, path, _ := split_include(include)
+		return open == "\"" || strings.HasPrefix(path, name + "/")
+	}
+	sort.SliceStable(sorted, func (i, j int) bool {
+		if local(sorted[i]) != local(sorted[j]) {
+			return !local(sorted[i])
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// Returns the header directory, relative to the package directory
+func include_dir (a *app.Application, meta Metadata) string {
+	if meta.Flat_includes {
+		return "include"
+	}
+	return "include/" + a.Name
+}
+
+// Plans the files rendered from templates (paths relative to the output directory)
+func application_files (a *app.Application, meta Metadata, build Build) []planned_file {
+	files := []planned_file{}
+	root_dir := package_root(a, meta)
+
+	// Workspace build script
+	if meta.Workspace && meta.Workspace_script {
+		files = append(files, planned_file{data: a, template: "workspace.tmpl", 
+			path: "build.sh", executable: true, optional: true})
+	}
+
+	// Executor source files
+	exec_template_file_name := fmt.Sprintf("executor_%d.tmpl", meta.Logging_mode)
+	header_template_file_name := fmt.Sprintf("executor_header_%d.tmpl", meta.Logging_mode)
+	for _, ros_exec := range build.Executors {
+		files = append(files, planned_file{data: ros_exec, template: exec_template_file_name, 
+			path: root_dir + "/src/" + ros_exec.Source})
+		if ros_exec.Header != "" {
+			files = append(files, planned_file{data: ros_exec, 
+				template: header_template_file_name, 
+				path: root_dir + "/" + include_dir(a, meta) + "/" + ros_exec.Header})
+		}
+	}
+
+	// Makefile and package descriptor (optionally merged into existing files)
+	cmake := planned_file{data: build, template: "CMakeLists.tmpl", 
+		path: root_dir + "/CMakeLists.txt"}
+	pkg := planned_file{data: build, template: "package.tmpl", 
+		path: root_dir + "/package.xml"}
+	if meta.Merge_build_files {
+		cmake.begin, cmake.end = "# BEGIN GEN", "# END GEN"
+		pkg.begin, pkg.end, pkg.xml = "<!-- BEGIN GEN -->", "<!-- END GEN -->", true
+	}
+	files = append(files, cmake, pkg)
+
+	// Dockerfile
+	if meta.Dockerfile {
+		files = append(files, planned_file{data: build, template: "Dockerfile.tmpl", 
+			path: root_dir + "/Dockerfile", optional: true})
+	}
+
+	// Package build script
+	if meta.Package_script {
+		files = append(files, planned_file{data: build, template: "package_script.tmpl", 
+			path: root_dir + "/build.sh", executable: true, optional: true})
+	}
+
+	// Launch file (executors optionally ordered by priority)
+	launch_build := build
+	if meta.Launch_by_priority {
+		launch_build.Executors = append([]ROS_Executor{}, build.Executors...)
+		sort.SliceStable(launch_build.Executors, func (i, j int) bool {
+			return executor_priority(launch_build.Executors[i]) > 
+				executor_priority(launch_build.Executors[j])
+		})
+	}
+	files = append(files, planned_file{data: launch_build, template: "launch.tmpl", 
+		path: root_dir + "/launch/" + build.Name + "_launch.py"})
+
+	// Apply the configured template extension
+	for i := range files {
+		files[i].template = template_name(files[i].template, meta)
+	}
+
+	return files
+}
+
+// Drops optional files whose template is absent from the template directory
+func available_files (files []planned_file, template_dir string) []planned_file {
+	available := []planned_file{}
+	for _, f := range files {
+		if f.optional && !exists_file_or_directory(template_dir + "/" + f.template) {
+			continue
+		}
+		available = append(available, f)
+	}
+	return available
+}
+
+// Plans the files copied into the package (directories relative to the output directory)
+func application_copies (a *app.Application, meta Metadata) []planned_copy {
+	root_dir := package_root(a, meta)
+	return []planned_copy{
+		{paths: meta.Libraries, dir: root_dir + "/lib", description: "libraries"},
+		{paths: meta.Headers, dir: root_dir + "/" + include_dir(a, meta), description: "headers"},
+		{paths: meta.Sources, dir: root_dir + "/src", description: "source files"},
+	}
+}
+
+// Plans the reports written to the assets directory (if requested)
+func application_reports (a *app.Application, meta Metadata, build Build) []planned_report {
+	reports := []planned_report{}
+	assets_dir := package_root(a, meta) + "/assets"
+
+	if meta.Priorities_report {
+		reports = append(reports, planned_report{path: assets_dir + "/priorities.md", 
+			content: priorities_report(build)})
+	}
+	if meta.Node_map {
+		reports = append(reports, planned_report{path: assets_dir + "/node_map.csv", 
+			content: node_map_report(build)})
+	}
+
+	return reports
+}
+
+// Returns a Markdown table of the nodes of each executor (by index) and their 
+// priorities (descending, then by node)
+func priorities_report (build Build) string {
+	var b strings.Builder
+
+	b.WriteString("| Executor | Node | Priority |\n")
+	b.WriteString("|---------:|-----:|---------:|\n")
+	executors := append([]ROS_Executor{}, build.Executors...)
+	sort.SliceStable(executors, func (i, j int) bool {
+		return executors[i].Index < executors[j].Index
+	})
+	for _, exec := range executors {
+		nodes := []int{}
+		for id := range exec.Node_prio_map {
+			nodes = append(nodes, id)
+		}
+		sort.Slice(nodes, func (i, j int) bool {
+			p, q := exec.Node_prio_map[nodes[i]], exec.Node_prio_map[nodes[j]]
+			return p > q || (p == q && nodes[i] < nodes[j])
+		})
+		for _, id := range nodes {
+			fmt.Fprintf(&b, "| %d | N%d | %d |\n", exec.Index, id, exec.Node_prio_map[id])
+		}
+	}
+
+	return b.String()
+}
+
+// Returns a CSV mapping of node IDs to the indices of the executors hosting them
+func node_map_report (build Build) string {
+	var b strings.Builder
+	type entry struct{ node, executor int }
+	entries := []entry{}
+
+	for _, exec := range build.Executors {
+		for _, id := range executor_nodes(exec.Executor) {
+			entries = append(entries, entry{id, exec.Index})
+		}
+	}
+	sort.SliceStable(entries, func (i, j int) bool {
+		return entries[i].node < entries[j].node
+	})
+
+	b.WriteString("node,executor\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%d,%d\n", e.node, e.executor)
+	}
+	return b.String()
+}
+
+// Renders the DOT sources of the chain and application graphs
+func dot_sources (a *app.Application, meta Metadata, graph_data Graphdata, 
+	template_dir string) (string, string, error) {
+
+	graphviz_graph, err := chain_graph(a, graph_data, meta)
+	if nil != err {
+		return "", "", errors.New("Unable to generate graphviz graph file: " + err.Error())
+	}
+	chain_dot, err := generate_string(graphviz_graph, template_dir + "/" + 
+		template_name("graph.dt", meta), meta.Delimiters)
+	if nil != err {
+		return "", "", errors.New("Unable to generate graph dot file: " + err.Error())
+	}
+
+	graphviz_application, err := application_graph(a, graph_data, meta)
+	if nil != err {
+		return "", "", errors.New("Unable to generate graphviz application file: " + 
+			err.Error())
+	}
+	application_dot, err := generate_string(graphviz_application, 
+		template_dir + "/" + template_name("application.dt", meta), meta.Delimiters)
+	if nil != err {
+		return "", "", errors.New("Unable to generate application dot file: " + err.Error())
+	}
+
+	return chain_dot, application_dot, nil
+}
+
+// Runs the tasks with at most 'limit' at once, and returns the first error (in task
+// order). With a limit below two, tasks run in order and stop at the first error
+func run_tasks (tasks []func() error, limit int) error {
+	if limit < 2 {
+		for _, task := range tasks {
+			if err := task(); nil != err {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs, slots := make([]error, len(tasks)), make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func (i int, task func() error) {
+			defer wg.Done()
+			errs[i] = task()
+			<-slots
+		}(i, task)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks the application, then renders its files and reports into memory, keyed
+// by their path relative to the output directory. Templates are read from the 
+// configured template directory (see BuildApplicationTree and EstimateSize)
+func render_application (a *app.Application, meta Metadata, 
+	graph_data Graphdata) (map[string]string, error) {
+	outputs := map[string]string{}
+
+	// Check: valid application
+	err := check_application(a, meta)
+	if nil != err {
+		return nil, err
+	}
+
+	// Check: libraries match the target machine (if configured)
+	err = check_libraries(meta)
+	if nil != err {
+		return nil, err
+	}
+
+	// Check: template directory
+	template_dir, err := configured_template_dir(meta)
+	if nil != err {
+		return nil, err
+	}
+
+	// Assemble the build
+	build, err := application_build(a, meta, graph_data)
+	if nil != err {
+		return nil, err
+	}
+
+	// Render files
+	for _, f := range available_files(application_files(a, meta, build), template_dir) {
+		output, err := render_file(f.data, template_dir + "/" + f.template, f.path, meta)
+		if nil != err {
+			return nil, errors.New("Unable to generate " + f.path + ": " + err.Error())
+		}
+		outputs[f.path] = output
+	}
+
+	// Write reports
+	for _, r := range application_reports(a, meta, build) {
+		outputs[r.path] = r.content
+	}
+
+	return outputs, nil
+}
+
+// Returns the configured template directory, which is required where there is 
+// no output path to derive it from
+func configured_template_dir (meta Metadata) (string, error) {
+	if meta.Template_dir == "" {
+		return "", errors.New("bad argument: no template directory configured")
+	}
+	return meta.Template_dir, nil
+}
+
+// Returns the filenames (without extension) of the chain and application graphs
+func graph_names (meta Metadata) (string, string) {
+	chain_name, application_name := meta.Chain_graph_name, meta.Application_graph_name
+	if chain_name == "" {
+		chain_name = default_chain_graph
+	}
+	if application_name == "" {
+		application_name = default_app_graph
+	}
+	return chain_name, application_name
+}
+
+// Renders a graph template as DOT source, checking that dot exists to render it
+func render_dot (data interface{}, template_path string, meta Metadata) (string, error) {
+
+	// Check: command exists
+	_, err := look_path("dot")
+	if nil != err {
+		return "", fmt.Errorf("%w: \"dot\": %s", ErrCommandNotFound, err.Error())
+	}
+
+	return generate_string(data, template_path, meta.Delimiters)
+}
+
+// Renders a graph template with dot into '<out_path>.png' in the filesystem. The 
+// DOT source is kept in '<out_path>.dot', and the plain layout in '<out_path>.plain'
+// if requested
+func render_graph (data interface{}, template_path, out_path string, meta Metadata) error {
+	fs := filesystem(meta)
+
+	// Render the DOT source
+	dot, err := render_dot(data, template_path, meta)
+	if nil != err {
+		return err
+	}
+	if meta.Keep_dot {
+		err = write_file(fs, out_path + ".dot", []byte(dot))
+		if nil != err {
+			return errors.New("unable to write dot file: " + err.Error())
+		}
+	}
+
+	// Render the layout coordinates (for debugging layouts)
+	if meta.Keep_plain {
+		plain, err := run_dot("plain", dot, meta)
+		if nil != err {
+			return err
+		}
+		err = write_file(fs, out_path + ".plain", plain)
+		if nil != err {
+			return errors.New("unable to write plain file: " + err.Error())
+		}
+	}
+
+	// Render the image
+	image, err := run_dot("png", dot, meta)
+	if nil != err {
+		return err
+	}
+	err = write_file(fs, out_path + ".png", image)
+	if nil != err {
+		return err
+	}
+
+	// Optimize the image (if requested)
+	if len(meta.Png_optimizer) > 0 {
+		return optimize_png(out_path + ".png", meta)
+	}
+	return nil
+}
+
+// Runs the configured optimizer on a PNG image (path appended as the last argument).
+// The step is skipped with a warning if the optimizer is not installed, or if the
+// image is not written to the OS filesystem
+func optimize_png (path string, meta Metadata) error {
+	var output bytes.Buffer
+	command := meta.Png_optimizer
+
+	// Check: image is on disk
+	if _, ok := filesystem(meta).(os_filesystem); !ok {
+		warn(meta, "Skipping PNG optimization of " + path + ": not written to disk")
+		return nil
+	}
+
+	// Check: command exists
+	_, err := look_path(command[0])
+	if nil != err {
+		warn(meta, "Skipping PNG optimization of " + path + ": " + command[0] + 
+			" is not installed")
+		return nil
+	}
+
+	cmd := exec_command(command[0], append(append([]string{}, command[1:]...), path)...)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err = cmd.Run()
+	if nil != err {
+		return fmt.Errorf("%w: \"%s\": %s: %s", ErrCommandFailed, command[0], err.Error(), 
+			strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// Runs dot on the DOT source with the given output format, and returns the output
+func run_dot (format, dot string, meta Metadata) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec_command("dot", append([]string{"-T" + format}, meta.Extra_dot_args...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = strings.NewReader(dot), &stdout, &stderr
+	err := cmd.Run()
+	if nil != err {
+		return nil, fmt.Errorf("%w: \"dot\": %s: %s", ErrCommandFailed, err.Error(), 
+			strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+/*
+ *******************************************************************************
+ *                         Private Graphviz Functions                          *
+ *******************************************************************************
+*/
+
+// Converts and validates the chain graph for rendering
+func chain_graph (a *app.Application, graph_data Graphdata, meta Metadata) (Graphviz_graph, 
+	error) {
+
+	// Check: chain nodes form a DAG (if requested)
+	if meta.Require_dag {
+		err := ValidateDAG(graph_data)
+		if nil != err {
+			return Graphviz_graph{}, err
+		}
+	}
+
+	g, err := graph_to_graphviz(graph_data, meta.Graph_style)
+	if nil != err {
+		return Graphviz_graph{}, err
+	}
+	err = ValidateGraphviz(g)
+	if nil != err {
+		return Graphviz_graph{}, errors.New("Invalid graphviz graph: " + err.Error())
+	}
+	g.Title = graph_title(a, meta.Graph_style)
+
+	// Report the disconnected nodes left out (if requested)
+	if meta.Warn_disconnected && len(g.Disconnected) > 0 {
+		names := []string{}
+		for _, id := range g.Disconnected {
+			names = append(names, fmt.Sprintf("N%d", id))
+		}
+		warn(meta, "Disconnected nodes left out of the chain graph: " + 
+			strings.Join(names, ", "))
+	}
+	return g, nil
+}
+
+// Converts and validates the application graph for rendering
+func application_graph (a *app.Application, graph_data Graphdata, 
+	meta Metadata) (Graphviz_application, error) {
+	g, err := application_to_graphviz(a, graph_data.Graph, meta.Graph_style)
+	if nil != err {
+		return Graphviz_application{}, err
+	}
+	err = ValidateGraphvizApplication(g)
+	if nil != err {
+		return Graphviz_application{}, errors.New("Invalid graphviz application: " + err.Error())
+	}
+	g.Title = graph_title(a, meta.Graph_style)
+	return g, nil
+}
+
+// Returns the title of rendered graphs: the application name and caption (if enabled)
+func graph_title (a *app.Application, style Graphstyle) string {
+	if !style.Title {
+		return ""
+	}
+	if style.Caption == "" {
+		return a.Name
+	}
+	return a.Name + "\n" + style.Caption
+}
+
+// Converts internal graph representation to graphviz application data structure
+func application_to_graphviz (a *app.Application, g *graph.Graph, 
+	style Graphstyle) (Graphviz_application, error) {
+	err := check_graph_size(g, style)
+	if nil != err {
+		return Graphviz_application{}, err
+	}
+	links := graph_links(g, style)
+	err = check_link_count(links, style)
+	if nil != err {
+		return Graphviz_application{}, err
+	}
+	if style.Undirected {
+		links = collapse_reciprocal(links)
+	}
+	return Graphviz_application{App: a, Links: links, Undirected: style.Undirected}, nil
+}
+
+// Converts internal graph representation to graphviz data structure
+func graph_to_graphviz (graph_data Graphdata, style Graphstyle) (Graphviz_graph, error) {
+	nodes := []Node{}
+
+	// Check: graph is small enough to render
+	err := check_graph_size(graph_data.Graph, style)
+	if nil != err {
+		return Graphviz_graph{}, err
+	}
+
+	// Apply WCET overrides to a copy of the WCET map
+	if len(style.Wcet_overrides) > 0 {
+		wcet_map := map[int]int64{}
+		for id, wcet := range graph_data.Node_wcet_map {
+			wcet_map[id] = wcet
+		}
+		for id, wcet := range style.Wcet_overrides {
+			wcet_map[id] = wcet
+		}
+		graph_data.Node_wcet_map = wcet_map
+	}
+
+	// Apply defaults to unset style options
+	sync_label, sync_fill := style.Sync_label, style.Sync_fill
+	if sync_label == "" {
+		sync_label = default_sync_label
+	}
+	if sync_fill == "" {
+		sync_fill = default_sync_fill
+	}
+
+	// Closure: Returns true if the given chain has a length of one
+	length_one_chain := func (row int) bool {
+		return graph_data.Chains[ops.ChainForRow(row, graph_data.Chains)] == 1
+	}
+
+	// Obtain the number of nodes that belong to chains
+	n_chain_nodes := ops.NodeCount(graph_data.Chains)
+
+	// Closure: Returns the name of a node in labels (with its chain and position 
+	// within the chain, if requested)
+	node_name := func (row int) string {
+		if !style.Chain_labels || row >= n_chain_nodes {
+			return fmt.Sprintf("N%d", row)
+		}
+		chain := ops.ChainForRow(row, graph_data.Chains)
+		position := row - ops.NodeCount(graph_data.Chains[:chain])
+		return fmt.Sprintf("N%d [c%d:%d]", row, chain, position)
+	}
+
+	// Create all nodes (but only if connected or chain has length 1)
+	disconnected := []int{}
+	for i := 0; i < graph_data.Graph.Len(); i++ {
+		if ops.Disconnected(i, graph_data.Graph) && !length_one_chain(i) {
+			disconnected = append(disconnected, i)
+		}
+		if !ops.Disconnected(i, graph_data.Graph) || length_one_chain(i) {
+
+			// It's a chain node if below the original graph node count
+			if i < n_chain_nodes {
+				label := fmt.Sprintf("%s\n(wcet=%d us)\nprio=%d", node_name(i), 
+					graph_data.Node_wcet_map[i], graph_data.Node_prio_map[i])
+				fill := "#FFFFFF"
+				if len(style.Chain_palette) > 0 {
+					chain := ops.ChainForRow(i, graph_data.Chains)
+					fill = style.Chain_palette[chain % len(style.Chain_palette)]
+				}
+				nodes = append(nodes, 
+					Node{Id: i, Label: label, Style: "filled", Fill: fill, Shape: "circle"})
+			} else {
+				label := fmt.Sprintf(sync_label, i, graph_data.Node_prio_map[i])
+				nodes = append(nodes, 
+					Node{Id: i, Label: label, Style: "filled", Fill: sync_fill, Shape: "diamond"})
+			}
+		
+		}
+	}
+
+	// Keep only nodes reachable from the subgraph root (if requested)
+	reachable := map[int]bool{}
+	if style.Subgraph {
+		if style.Subgraph_root < 0 || style.Subgraph_root >= graph_data.Graph.Len() {
+			return Graphviz_graph{}, fmt.Errorf("subgraph root %d is not a node", 
+				style.Subgraph_root)
+		}
+		adjacent, queue := adjacency(graph_data.Graph), []int{style.Subgraph_root}
+		reachable[style.Subgraph_root] = true
+		for len(queue) > 0 {
+			u := queue[0]
+			queue = queue[1:]
+			for _, v := range adjacent[u] {
+				if !reachable[v] {
+					reachable[v] = true
+					queue = append(queue, v)
+				}
+			}
+		}
+		kept := []Node{}
+		for _, node := range nodes {
+			if reachable[node.Id] {
+				kept = append(kept, node)
+			}
+		}
+		nodes = kept
+	}
+
+	// Order chain nodes by execution order (if requested)
+	hints := []Link{}
+	if style.Order_chains {
+		nodes, hints = order_chain_nodes(nodes, graph_data)
+	}
+
+	// Give nodes HTML-like labels (if requested)
+	if style.Html_labels {
+		for i := range nodes {
+			id := nodes[i].Id
+			row := fmt.Sprintf("<TR><TD>wcet</TD><TD>%d us</TD></TR>", graph_data.Node_wcet_map[id])
+			if id >= n_chain_nodes {
+				row = "<TR><TD COLSPAN=\"2\">SYNC</TD></TR>"
+			}
+			nodes[i].HTMLLabel = fmt.Sprintf("<TABLE BORDER=\"0\" CELLBORDER=\"1\" " + 
+				"CELLSPACING=\"0\"><TR><TD COLSPAN=\"2\"><B>%s</B></TD></TR>%s" + 
+				"<TR><TD>prio</TD><TD>%d</TD></TR></TABLE>", node_name(id), row, 
+				graph_data.Node_prio_map[id])
+		}
+	}
+
+	// Style node borders by priority
+	for i := range nodes {
+		nodes[i].PenWidth, nodes[i].BorderColor = default_pen_width, default_border_color
+		if nil != style.Priority_border {
+			nodes[i].PenWidth, nodes[i].BorderColor = 
+				style.Priority_border(graph_data.Node_prio_map[nodes[i].Id])
+		}
+	}
+
+	// Group the chain nodes by chain (if requested)
+	ranks := [][]int{}
+	if style.Rank_chains {
+		ranks = make([][]int, len(graph_data.Chains))
+		for _, node := range nodes {
+			if node.Id < n_chain_nodes {
+				chain := ops.ChainForRow(node.Id, graph_data.Chains)
+				ranks[chain] = append(ranks[chain], node.Id)
+			}
+		}
+	}
+
+	// Cluster the chain nodes by chain (if requested)
+	clusters := []Cluster{}
+	if style.Cluster_chains {
+		members := make([][]int, len(graph_data.Chains))
+		for _, node := range nodes {
+			if node.Id < n_chain_nodes {
+				chain := ops.ChainForRow(node.Id, graph_data.Chains)
+				members[chain] = append(members[chain], node.Id)
+			}
+		}
+		for chain, ids := range members {
+			if len(ids) == 0 {
+				continue
+			}
+			cluster := Cluster{Index: chain, Nodes: ids, Label: fmt.Sprintf(default_cluster_label, 
+				chain), Color: default_cluster_color, BGColor: default_cluster_bgcolor}
+			if nil != style.Cluster_style {
+				cluster.Label, cluster.Color, cluster.BGColor = style.Cluster_style(chain)
+			}
+			clusters = append(clusters, cluster)
+		}
+	}
+
+	links := graph_links(graph_data.Graph, style)
+	err = check_link_count(links, style)
+	if nil != err {
+		return Graphviz_graph{}, err
+	}
+	if style.Subgraph {
+		kept := []Link{}
+		for _, link := range links {
+			if reachable[link.From] && reachable[link.To] {
+				kept = append(kept, link)
+			}
+		}
+		links = kept
+	}
+
+	if style.Undirected {
+		links = collapse_reciprocal(links)
+	}
+
+	// Give nodes tooltips with their timing, chain, and incident edges (if requested)
+	if style.Tooltips {
+		for i := range nodes {
+			id, chain := nodes[i].Id, "SYNC"
+			if id < n_chain_nodes {
+				chain = fmt.Sprintf("%d", ops.ChainForRow(id, graph_data.Chains))
+			}
+			tooltip := fmt.Sprintf("N%d\nwcet: %d us\nprio: %d\nchain: %s", id, 
+				graph_data.Node_wcet_map[id], graph_data.Node_prio_map[id], chain)
+			for _, link := range links {
+				if link.From == id || link.To == id {
+					tooltip += fmt.Sprintf("\nN%d -> N%d", link.From, link.To)
+				}
+			}
+			nodes[i].Tooltip = tooltip
+		}
+	}
+
+	links = append(links, hints...)
+
+	// Highlight the critical path (if requested)
+	if style.Critical_path {
+		critical_color := style.Critical_color
+		if critical_color == "" {
+			critical_color = default_critical_color
+		}
+		path, _, err := CriticalPath(graph_data)
+		if nil != err {
+			return Graphviz_graph{}, err
+		}
+		on_path, next := map[int]bool{}, map[int]int{}
+		for k, id := range path {
+			on_path[id] = true
+			if k + 1 < len(path) {
+				next[id] = path[k + 1]
+			}
+		}
+		for i := range nodes {
+			if on_path[nodes[i].Id] {
+				nodes[i].BorderColor = critical_color
+			}
+		}
+		for i := range links {
+			if to, ok := next[links[i].From]; ok && to == links[i].To {
+				links[i].Color = critical_color
+			}
+			if to, ok := next[links[i].To]; ok && to == links[i].From && style.Undirected {
+				links[i].Color = critical_color
+			}
+		}
+	}
+
+	return Graphviz_graph{Nodes: nodes, Links: links, Ranks: ranks, Clusters: clusters, 
+		Disconnected: disconnected, Undirected: style.Undirected}, nil
+}
+
+// Returns the successors of every node in the graph
+func adjacency (g *graph.Graph) [][]int {
+	adjacent := make([][]int, g.Len())
+	for i := 0; i < g.Len(); i++ {
+		for j := 0; j < g.Len(); j++ {
+			if len(ops.EdgesAt(i, j, g)) > 0 {
+				adjacent[i] = append(adjacent[i], j)
+			}
+		}
+	}
+	return adjacent
+}
+
+// Returns the nodes of the graph in topological order, or an error on a cycle
+func topological_order (g *graph.Graph) ([]int, error) {
+	adjacent, in_degree := adjacency(g), make([]int, g.Len())
+	for _, successors := range adjacent {
+		for _, v := range successors {
+			in_degree[v]++
+		}
+	}
+
+	// Repeatedly remove nodes without remaining predecessors
+	order, queue := []int{}, []int{}
+	for u := range in_degree {
+		if in_degree[u] == 0 {
+			queue = append(queue, u)
+		}
+	}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		order = append(order, u)
+		for _, v := range adjacent[u] {
+			in_degree[v]--
+			if in_degree[v] == 0 {
+				queue = append(queue, v)
+			}
+		}
+	}
+	if len(order) != g.Len() {
+		return order, errors.New("graph contains a cycle")
+	}
+	return order, nil
+}
+
+// Orders chain nodes chain by chain, following the edges within each chain, and 
+// returns them (followed by the remaining nodes) with invisible links between 
+// consecutive nodes of each chain
+func order_chain_nodes (nodes []Node, graph_data Graphdata) ([]Node, []Link) {
+	ordered, hints := []Node{}, []Link{}
+	n_chain_nodes := ops.NodeCount(graph_data.Chains)
+	adjacent := adjacency(graph_data.Graph)
+
+	// Group nodes by chain
+	members, others := make([][]Node, len(graph_data.Chains)), []Node{}
+	for _, node := range nodes {
+		if node.Id < n_chain_nodes {
+			chain := ops.ChainForRow(node.Id, graph_data.Chains)
+			members[chain] = append(members[chain], node)
+		} else {
+			others = append(others, node)
+		}
+	}
+
+	// Order each chain topologically over its internal edges (ties by ID)
+	for _, chain := range members {
+		in_chain, in_degree := map[int]Node{}, map[int]int{}
+		for _, node := range chain {
+			in_chain[node.Id] = node
+		}
+		for _, node := range chain {
+			for _, v := range adjacent[node.Id] {
+				if _, ok := in_chain[v]; ok {
+					in_degree[v]++
+				}
+			}
+		}
+		previous := -1
+		for len(in_chain) > 0 {
+
+			// Select the lowest ID without predecessors (or the lowest, on a cycle)
+			next := -1
+			for id := range in_chain {
+				if in_degree[id] == 0 && (next < 0 || id < next) {
+					next = id
+				}
+			}
+			if next < 0 {
+				for id := range in_chain {
+					if next < 0 || id < next {
+						next = id
+					}
+				}
+			}
+
+			ordered = append(ordered, in_chain[next])
+			delete(in_chain, next)
+			for _, v := range adjacent[next] {
+				in_degree[v]--
+			}
+			if previous >= 0 {
+				hints = append(hints, Link{From: previous, To: next, Style: "invis"})
+			}
+			previous = next
+		}
+	}
+
+	return append(ordered, others...), hints
+}
+
+// Returns an error if the graph has more nodes than may be rendered
+func check_graph_size (g *graph.Graph, style Graphstyle) error {
+	max_nodes := style.Max_nodes
+	if max_nodes <= 0 {
+		max_nodes = default_max_nodes
+	}
+	if g.Len() > max_nodes {
+		return fmt.Errorf("graph has %d nodes, exceeding the limit of %d", g.Len(), max_nodes)
+	}
+	return nil
+}
+
+// Returns an error if there are more links than may be rendered
+func check_link_count (links []Link, style Graphstyle) error {
+	max_edges := style.Max_edges
+	if max_edges <= 0 {
+		max_edges = default_max_edges
+	}
+	if len(links) > max_edges {
+		return fmt.Errorf("graph has %d edges, exceeding the limit of %d", len(links), max_edges)
+	}
+	return nil
+}
+
+// Creates links for all edges in the graph
+func graph_links (g *graph.Graph, style Graphstyle) []Link {
+	links := []Link{}
+	for i := 0; i < g.Len(); i++ {
+		for j := 0; j < g.Len(); j++ {
+			edges := ops.EdgesAt(i, j, g)
+			for _, e := range edges {
+				label := fmt.Sprintf("%d.%d", e.Tag, e.Num)
+				key := Edge_key{i, j, e.Tag, e.Num}
+				if text, ok := style.Annotations[key]; ok {
+					label += "\n" + text
+				}
+				if nil != style.Label_edge && !style.Label_edge(key) {
+					label = ""
+				}
+				arrowhead, color := "", e.Color
+				if nil != style.Arrowhead {
+					arrowhead = style.Arrowhead(e)
+				}
+				if nil != style.Edge_color {
+					if c := style.Edge_color(e); c != "" {
+						color = c
+					}
+				}
+				links = append(links, Link{From: i, To: j, Color: color, Label: label, 
+					Arrowhead: arrowhead})
+			}
+		}
+	}
+	return links
+}
+
+// Collapses reciprocal links (a -> b and b -> a) into one, keeping the first
+func collapse_reciprocal (links []Link) []Link {
+	kept, unmatched := []Link{}, map[[2]int]int{}
+	for _, l := range links {
+		if unmatched[[2]int{l.To, l.From}] > 0 && l.From != l.To {
+			unmatched[[2]int{l.To, l.From}]--
+			continue
+		}
+		unmatched[[2]int{l.From, l.To}]++
+		kept = append(kept, l)
+	}
+	return kept
+}
+
+
+/*
+ *******************************************************************************
+ *                          Private Support Functions                          *
+ *******************************************************************************
 */
 
 
-// Copies a file 
-func copy_file (from, to string) error {
+// Returns an error if the output path resolves inside the template directory 
+// (following symbolic links)
+func check_output_path (out_path, template_dir string) error {
+	abs_out, err := resolve_path(out_path)
+	if nil != err {
+		return errors.New("unable to resolve output file (" + out_path + "): " + err.Error())
+	}
+	abs_dir, err := resolve_path(template_dir)
+	if nil != err {
+		return errors.New("unable to resolve template dir (" + template_dir + "): " + err.Error())
+	}
+	rel, err := filepath.Rel(abs_dir, abs_out)
+	if nil == err && rel != ".." && !strings.HasPrefix(rel, ".." + string(filepath.Separator)) {
+		return errors.New("output file (" + out_path + ") would overwrite the template dir (" + 
+			template_dir + ")")
+	}
+	return nil
+}
+
+// Returns the absolute path with symbolic links resolved. A path that does not
+// exist yet is resolved through its parent directory (if that exists)
+func resolve_path (path string) (string, error) {
+	if resolved, err := filepath.EvalSymlinks(path); nil == err {
+		return filepath.Abs(resolved)
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); nil == err {
+		return filepath.Abs(filepath.Join(dir, filepath.Base(path)))
+	}
+	return filepath.Abs(path)
+}
+
+// Renders a template at 'path' (parsed with the given delimiters), and returns 
+// the output
+func generate_string (data interface{}, path string, delimiters [2]string) (string, 
+	error) {
+	var b strings.Builder
+
+	err := generate_template_to(data, path, delimiters, &b)
+	if nil != err {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Renders a template at 'path' (parsed with the given delimiters) into a writer
+func generate_template_to (data interface{}, path string, delimiters [2]string, 
+	w io.Writer) error {
+	var t *template.Template = nil
+	var err error = nil
+
+	// Check: valid input
+	if nil == data || nil == w {
+		return errors.New("bad argument: null pointer")
+	}
+
+	// Read and parse the template file
+	t, err = parse_template(path, delimiters)
+	if nil != err {
+		return err
+	}
+
+	// Execute template
+	err = t.Execute(w, data)
+	if nil != err {
+		return errors.New("error executing template: " + err.Error())
+	}
+
+	return nil
+}
+
+// Renders a template for the file at 'out_path', applying the output options of 
+// the metadata
+func render_file (data interface{}, in_path, out_path string, meta Metadata) (string, 
+	error) {
+
+	// Render the template
+	output, err := generate_string(data, in_path, meta.Delimiters)
+	if nil != err {
+		return "", err
+	}
+
+	// Apply output options
+	if meta.File_header != "" {
+		source_extension := meta.Source_extension
+		if source_extension == "" {
+			source_extension = default_source_extension
+		}
+		with_header, ok := add_file_header(output, meta.File_header, out_path, 
+			source_extension)
+		if !ok {
+			warn(meta, "File_header not added to " + out_path + " (unknown comment syntax)")
+		}
+		output = with_header
+	}
+	if meta.Normalize_newlines {
+		output = strings.ReplaceAll(output, "\r\n", "\n")
+	}
+	if meta.Trailing_newline {
+		output = strings.TrimRight(output, "\r\n") + "\n"
+	}
+
+	return output, nil
+}
+
+// Prepends the header to the output as a comment in the syntax of the output file 
+// type, after any interpreter line (#!) or XML declaration. The output of files 
+// of unknown types is returned unchanged (false)
+func add_file_header (output, header, out_path, source_extension string) (string, bool) {
+	var comment []string = nil
+	base, extension := filepath.Base(out_path), filepath.Ext(out_path)
+
+	// Comment the header lines
+	lines := strings.Split(strings.TrimRight(header, "\r\n"), "\n")
+	switch {
+	case is_source_file(out_path, source_extension) || is_header_file(out_path):
+		comment = comment_lines(lines, "// ", "")
+	case base == "CMakeLists.txt" || base == "Dockerfile" || extension == ".cmake" || 
+		extension == ".py" || extension == ".sh":
+		comment = comment_lines(lines, "# ", "")
+	case extension == ".xml":
+		for i := range lines {
+			lines[i] = strings.ReplaceAll(lines[i], "--", "- -")
+		}
+		comment = comment_lines(lines, "<!-- ", " -->")
+	default:
+		return output, false
+	}
+	text := strings.Join(comment, "\n") + "\n"
+
+	// Keep interpreter lines and XML declarations first
+	end := ""
+	switch {
+	case strings.HasPrefix(output, "#!"):
+		end = "\n"
+	case extension == ".xml" && strings.HasPrefix(output, "<?xml"):
+		end = "?>"
+	default:
+		return text + output, true
+	}
+	i := strings.Index(output, end)
+	if i < 0 {
+		return output + "\n" + text, true
+	}
+	i += len(end)
+	if end == "?>" && strings.HasPrefix(output[i:], "\n") {
+		i++
+	}
+	if !strings.HasSuffix(output[:i], "\n") {
+		text = "\n" + text
+	}
+	return output[:i] + text + output[i:], true
+}
+
+// Returns the lines as comments, between the given prefix and suffix
+func comment_lines (lines []string, prefix, suffix string) []string {
+	comment := []string{}
+	for _, line := range lines {
+		comment = append(comment, strings.TrimRight(prefix + line + suffix, " "))
+	}
+	return comment
+}
+
+// Generates a file from a template, applying the output options of the metadata
+func generate_file (data interface{}, in_path, out_path string, meta Metadata) error {
+
+	// Check: templates are not overwritten
+	err := check_output_path(out_path, filepath.Dir(in_path))
+	if nil != err {
+		return err
+	}
+
+	// Render the template
+	output, err := render_file(data, in_path, out_path, meta)
+	if nil != err {
+		return err
+	}
+
+	// Write the output file
+	err = write_file(filesystem(meta), out_path, []byte(output))
+	if nil != err {
+		return errors.New("unable to write output file (" + out_path + "): " + err.Error())
+	}
+	return nil
+}
+
+// Generates a file from a template, but only replaces the region between the 
+// begin and end markers if the output file exists. Without a region the 
+// rendered region is appended to the existing content. For XML ('xml' set) the
+// region holds the content of the root element, and is kept inside it
+func generate_region (data interface{}, in_path, out_path, begin, end string, 
+	xml bool, meta Metadata) error {
+	var content string = ""
+	var prefix, suffix string = "", ""
+
+	// Check: templates are not overwritten
+	err := check_output_path(out_path, filepath.Dir(in_path))
+	if nil != err {
+		return err
+	}
+
+	// Render the template (only the root element content for XML)
+	output, err := render_file(data, in_path, out_path, meta)
+	if nil != err {
+		return err
+	}
+	if xml {
+		prefix, output, suffix, err = split_xml_root(output)
+		if nil != err {
+			return errors.New("unable to place generation markers (" + in_path + "): " + 
+				err.Error())
+		}
+		output = strings.TrimPrefix(output, "\n")
+	}
+	if !strings.HasSuffix(output, "\n") {
+		output += "\n"
+	}
+	region := begin + "\n" + output + end
+
+	// Read existing content (if any)
+	exists := false
+	if _, err := filesystem(meta).Stat(out_path); nil == err {
+		existing, err := read_file(filesystem(meta), out_path)
+		if nil != err {
+			return errors.New("unable to read output file (" + out_path + "): " + err.Error())
+		}
+		content, exists = string(existing), true
+	}
+
+	// Replace the existing region, or add a new one
+	i, j := strings.Index(content, begin), strings.Index(content, end)
+	switch {
+	case i >= 0 && j > i:
+		content = content[:i] + region + content[j + len(end):]
+	case i >= 0 || j >= 0:
+		return errors.New("unbalanced generation markers in output file (" + out_path + ")")
+	case xml && !exists:
+		content = prefix + "\n" + region + "\n" + suffix
+	case xml:
+		k := strings.LastIndex(content, "</")
+		if k < 0 {
+			return errors.New("no closing root element in output file (" + out_path + ")")
+		}
+		content = content[:k] + region + "\n" + content[k:]
+	default:
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		content += region + "\n"
+	}
+
+	// Write the output file
+	err = write_file(filesystem(meta), out_path, []byte(content))
+	if nil != err {
+		return errors.New("unable to write output file (" + out_path + "): " + err.Error())
+	}
+	return nil
+}
+
+// Splits an XML document into the part up to and including the root start tag,
+// the content of the root element, and the closing root tag onwards. The 
+// declaration, comments, and doctype before the root element are skipped
+func split_xml_root (s string) (string, string, string, error) {
+	i := 0
+	for {
+		k := strings.Index(s[i:], "<")
+		if k < 0 {
+			return "", "", "", errors.New("no root element")
+		}
+		i += k
+		if !strings.HasPrefix(s[i:], "<?") && !strings.HasPrefix(s[i:], "<!") {
+			break
+		}
+		closing := ">"
+		if strings.HasPrefix(s[i:], "<!--") {
+			closing = "-->"
+		}
+		k = strings.Index(s[i:], closing)
+		if k < 0 {
+			return "", "", "", errors.New("unterminated markup before the root element")
+		}
+		i += k + len(closing)
+	}
+
+	// The root start tag must be followed by content and a closing tag
+	k := strings.Index(s[i:], ">")
+	if k < 0 {
+		return "", "", "", errors.New("unterminated root start tag")
+	}
+	if strings.HasSuffix(s[i:i + k], "/") {
+		return "", "", "", errors.New("root element is empty (" + s[i:i + k + 1] + ")")
+	}
+	start := i + k + 1
+	j := strings.LastIndex(s, "</")
+	if j < start {
+		return "", "", "", errors.New("no closing root element")
+	}
+	return s[:start], s[start:j], s[j:], nil
+}
+
+// Calls 'visit' for every node in a template parse tree (depth first)
+func walk_template (n parse.Node, visit func (parse.Node)) {
+	if nil == n {
+		return
+	}
+	visit(n)
+	switch node := n.(type) {
+	case *parse.ListNode:
+		if nil == node {
+			return
+		}
+		for _, child := range node.Nodes {
+			walk_template(child, visit)
+		}
+	case *parse.ActionNode:
+		walk_template(node.Pipe, visit)
+	case *parse.IfNode:
+		walk_template(node.Pipe, visit)
+		walk_template(node.List, visit)
+		walk_template(node.ElseList, visit)
+	case *parse.RangeNode:
+		walk_template(node.Pipe, visit)
+		walk_template(node.List, visit)
+		walk_template(node.ElseList, visit)
+	case *parse.WithNode:
+		walk_template(node.Pipe, visit)
+		walk_template(node.List, visit)
+		walk_template(node.ElseList, visit)
+	case *parse.TemplateNode:
+		walk_template(node.Pipe, visit)
+	case *parse.PipeNode:
+		if nil == node {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			walk_template(cmd, visit)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			walk_template(arg, visit)
+		}
+	case *parse.ChainNode:
+		walk_template(node.Node, visit)
+	}
+}
+
+// Calls 'add' for every field path referenced below 'n', where 'dot' is the 
+// path of '.' (if 'known'). Templates invoked with the same context are only 
+// followed once ('visiting' guards against recursive templates)
+func collect_template_fields (t *template.Template, n parse.Node, dot string, 
+	known bool, visiting map[string]bool, add func (string)) {
+	walk := func (n parse.Node, dot string, known bool) {
+		collect_template_fields(t, n, dot, known, visiting, add)
+	}
+
+	switch node := n.(type) {
+	case *parse.ListNode:
+		if nil == node {
+			return
+		}
+		for _, child := range node.Nodes {
+			walk(child, dot, known)
+		}
+	case *parse.ActionNode:
+		walk(node.Pipe, dot, known)
+	case *parse.IfNode:
+		walk(node.Pipe, dot, known)
+		walk(node.List, dot, known)
+		walk(node.ElseList, dot, known)
+	case *parse.RangeNode:
+		walk(node.Pipe, dot, known)
+		path, ok := pipe_field_path(node.Pipe, dot, known)
+		walk(node.List, path + "[]", ok)
+		walk(node.ElseList, dot, known)
+	case *parse.WithNode:
+		walk(node.Pipe, dot, known)
+		path, ok := pipe_field_path(node.Pipe, dot, known)
+		walk(node.List, path, ok)
+		walk(node.ElseList, dot, known)
+	case *parse.TemplateNode:
+		walk(node.Pipe, dot, known)
+		path, ok := pipe_field_path(node.Pipe, dot, known)
+		key := node.Name + "|" + path
+		invoked := t.Lookup(node.Name)
+		if !ok || visiting[key] || nil == invoked || nil == invoked.Tree {
+			return
+		}
+		visiting[key] = true
+		walk(invoked.Tree.Root, path, true)
+	case *parse.PipeNode:
+		if nil == node {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			walk(cmd, dot, known)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			walk(arg, dot, known)
+		}
+	case *parse.ChainNode:
+		walk(node.Node, dot, known)
+	case *parse.FieldNode:
+		if known {
+			add(dot + "." + strings.Join(node.Ident, "."))
+		}
+	case *parse.VariableNode:
+		if node.Ident[0] == "$" && len(node.Ident) > 1 {
+			add("." + strings.Join(node.Ident[1:], "."))
+		}
+	}
+}
+
+// Returns the field path a pipeline selects, if it is a single field, '.', or 
+// '$' (optionally with fields). Other pipelines have no known path
+func pipe_field_path (pipe *parse.PipeNode, dot string, known bool) (string, bool) {
+	if nil == pipe || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return "", false
+	}
+	switch node := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return dot, known
+	case *parse.FieldNode:
+		return dot + "." + strings.Join(node.Ident, "."), known
+	case *parse.VariableNode:
+		if node.Ident[0] == "$" {
+			return strings.Join(append([]string{""}, node.Ident[1:]...), "."), true
+		}
+	}
+	return "", false
+}
+
+// Returns the optional delimiters of a standalone function (default: "{{" and "}}")
+func optional_delimiters (delimiters [][2]string) [2]string {
+	if len(delimiters) > 0 {
+		return delimiters[0]
+	}
+	return [2]string{}
+}
+
+// Reads and parses the template file at 'path' with the given delimiters (naming 
+// the template by its path)
+func parse_template (path string, delimiters [2]string) (*template.Template, error) {
+	template_buffer, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, errors.New("unable to read template (" + path + "): " + err.Error())
+	}
+
+	// Transparently decompress gzipped templates
+	if strings.HasSuffix(path, ".gz") || bytes.HasPrefix(template_buffer, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(template_buffer))
+		if nil != err {
+			return nil, errors.New("unable to decompress template (" + path + "): " + err.Error())
+		}
+		template_buffer, err = ioutil.ReadAll(reader)
+		if nil != err {
+			return nil, errors.New("unable to decompress template (" + path + "): " + err.Error())
+		}
+	}
+
+	// Check: all called functions are defined (named clearly, unlike the parser)
+	err = check_template_funcs(path, string(template_buffer), delimiters)
+	if nil != err {
+		return nil, err
+	}
+
+	t, err := template.New(path).Delims(delimiters[0], delimiters[1]).Funcs(
+		template_funcs).Parse(string(template_buffer))
+	if nil != err {
+		return nil, errors.New("unable to parse template (" + path + "): " + err.Error())
+	}
+	return t, nil
+}
+
+// Returns the value as a (double-quoted) Python string literal. Go quoting 
+// only uses escapes that Python interprets identically
+func python_string (value interface{}) string {
+	return strconv.Quote(fmt.Sprint(value))
+}
+
+// Returns the integers [0, n) (e.g. for iterating over PPE levels in templates)
+func sequence (n int) []int {
+	s := []int{}
+	for i := 0; i < n; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+// Returns the identifier used for the given PPE priority level in generated code
+func priority_name (level int) string {
+	return fmt.Sprintf("priority_level_%d", level)
+}
+
+// Returns an error naming the functions called by a template that are neither 
+// builtin nor in the template functions. Syntax errors are left to the parser
+func check_template_funcs (path, text string, delimiters [2]string) error {
+	unknown, seen := []string{}, map[string]bool{}
+
+	tree := parse.New(path)
+	tree.Mode = parse.SkipFuncCheck
+	trees := map[string]*parse.Tree{}
+	_, err := tree.Parse(text, delimiters[0], delimiters[1], trees)
+	if nil != err {
+		return nil
+	}
+
+	for _, t := range trees {
+		walk_template(t.Root, func (n parse.Node) {
+			id, ok := n.(*parse.IdentifierNode)
+			if !ok || builtin_funcs[id.Ident] || nil != template_funcs[id.Ident] || 
+				seen[id.Ident] {
+				return
+			}
+			seen[id.Ident] = true
+			unknown = append(unknown, id.Ident)
+		})
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return errors.New("template (" + path + ") calls unknown functions: " + 
+			strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// Returns an error naming the first link with an undeclared endpoint
+func validate_links (links []Link, declared map[int]bool) error {
+	for _, l := range links {
+		if !declared[l.From] {
+			return fmt.Errorf("link %d -> %d: undeclared source node %d", l.From, l.To, l.From)
+		}
+		if !declared[l.To] {
+			return fmt.Errorf("link %d -> %d: undeclared destination node %d", l.From, l.To, l.To)
+		}
+	}
+	return nil
+}
+
+// Returns the graph node IDs of the callbacks hosted by an executor
+func executor_nodes (e app.Executor) []int {
+	ids := []int{}
+	for _, c := range e.Callbacks {
+		ids = append(ids, c.Id)
+	}
+	return ids
+}
+
+// Returns the (sorted) chains in which an executor has nodes
+func executor_chains (e app.Executor, graph_data Graphdata) []int {
+	chains, seen := []int{}, map[int]bool{}
+	n_chain_nodes := ops.NodeCount(graph_data.Chains)
+	for _, id := range executor_nodes(e) {
+
+		// SYNC nodes do not belong to any chain
+		if id >= n_chain_nodes {
+			continue
+		}
+		chain := ops.ChainForRow(id, graph_data.Chains)
+		if !seen[chain] {
+			seen[chain] = true
+			chains = append(chains, chain)
+		}
+	}
+	sort.Ints(chains)
+	return chains
+}
+
+// Runs the configured linter on the package directory (appended as the last 
+// argument), and returns its output. The output is included in the error if 
+// it fails
+func run_linter (package_dir string, meta Metadata) (string, error) {
+	var output bytes.Buffer
+
+	command := meta.Linter_command
+	if len(command) == 0 {
+		command = []string{default_linter}
+	}
+
+	// Check: command exists
+	_, err := look_path(command[0])
+	if nil != err {
+		return "", fmt.Errorf("%w: \"%s\": %s", ErrCommandNotFound, command[0], err.Error())
+	}
+
+	// Run the linter
+	cmd := exec_command(command[0], append(append([]string{}, command[1:]...), 
+		package_dir)...)
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err = cmd.Run()
+	if nil != err {
+		return "", fmt.Errorf("%w: \"%s\": %s: %s", ErrCommandFailed, command[0], 
+			err.Error(), strings.TrimSpace(output.String()))
+	}
+	return strings.TrimSpace(output.String()), nil
+}
+
+// Returns the highest priority among the nodes of an executor
+func executor_priority (e ROS_Executor) int {
+	var prio, first = 0, true
+	for _, p := range e.Node_prio_map {
+		if first || p > prio {
+			prio, first = p, false
+		}
+	}
+	return prio
+}
+
+// Copies a file (from the OS) into the filesystem
+func copy_file (from, to string, meta Metadata) error {
+	fs := filesystem(meta)
+
+	// Recreate symbolic links (if requested) instead of copying their target
+	if meta.Preserve_symlinks {
+		info, err := os.Lstat(from)
+		if nil != err {
+			return err
+		}
+		if 0 != info.Mode() & os.ModeSymlink {
+			return copy_symlink(fs, from, to)
+		}
+	}
+
+	// Skip byte-identical destinations (if requested), preserving their mtime
+	if meta.Skip_identical_copies {
+		identical, err := identical_files(from, to, fs)
+		if nil != err {
+			return err
+		}
+		if identical {
+			return nil
+		}
+	}
+
 	file_from, err := os.Open(from)
 	if nil != err {
 		return err
 	}
 	defer file_from.Close()
 
-	file_to, err := os.OpenFile(to, os.O_RDWR | os.O_CREATE, 0777)
+	file_to, err := fs.Create(to)
 	if nil != err {
 		return err
 	}
-	defer file_to.Close()
 
 	_, err = io.Copy(file_to, file_from)
 	if nil != err {
+		file_to.Close()
 		return err
 	}
-	return nil
+	return file_to.Close()
+}
+
+// Recreates the symbolic link at 'from' as 'to' (replacing any existing file)
+func copy_symlink (fs FileSystem, from, to string) error {
+	s, ok := fs.(interface{ Symlink(string, string) error })
+	if !ok {
+		return errors.New("filesystem does not support symbolic links (" + from + ")")
+	}
+	target, err := os.Readlink(from)
+	if nil != err {
+		return err
+	}
+	err = fs.RemoveAll(to)
+	if nil != err {
+		return err
+	}
+	return s.Symlink(target, to)
 }
 
 // Copy files (full path) to a destination folder
-func copy_files_to (paths []string, destination string) error {
+func copy_files_to (paths []string, destination string, meta Metadata) error {
+	fs := filesystem(meta)
 
 	// Check if destination exists
-	if !exists_file_or_directory(destination) {
+	if _, err := fs.Stat(destination); nil != err {
 		return errors.New("Unable to locate: " + destination)
 	}
 
@@ -461,6 +3138,13 @@ func copy_files_to (paths []string, destination string) error {
 			return errors.New("Unable to locate: " + path)
 		}
 
+		// Check: not empty (if requested)
+		if meta.Reject_empty_copies {
+			if info, err := os.Stat(path); nil == err && info.Size() == 0 {
+				return errors.New("Refusing to copy empty file: " + path)
+			}
+		}
+
 		// Strip down to the filename
 		filename, err := filename_from_path(path)
 		if nil != err {
@@ -468,7 +3152,7 @@ func copy_files_to (paths []string, destination string) error {
 		}
 
 		// Copy over
-		err = copy_file(path, destination + "/" + filename)
+		err = copy_file(path, destination + "/" + filename, meta)
 		if nil != err {
 			return err
 		}
@@ -476,6 +3160,173 @@ func copy_files_to (paths []string, destination string) error {
 	return nil
 }
 
+// Returns true if the path names a C/C++ source file
+func is_source_file (path, source_extension string) bool {
+	for _, extension := range []string{".c", ".cc", ".cpp", ".cxx", "." + source_extension} {
+		if strings.HasSuffix(path, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the path names a C/C++ header file
+func is_header_file (path string) bool {
+	for _, extension := range []string{".h", ".hh", ".hpp", ".hxx"} {
+		if strings.HasSuffix(path, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns warnings for local (quoted) includes in the sources that name none of 
+// the given header files. Includes may be prefixed with the package name
+func orphan_includes (fs FileSystem, sources []string, headers map[string]bool, 
+	name string) ([]string, error) {
+	warnings := []string{}
+	include := regexp.MustCompile(`(?m)^\s*#\s*include\s*"([^"]+)"`)
+	for _, source := range sources {
+		content, err := read_file(fs, source)
+		if nil != err {
+			return []string{}, err
+		}
+		for _, match := range include.FindAllStringSubmatch(string(content), -1) {
+			header := strings.TrimPrefix(match[1], name + "/")
+			if !headers[header] {
+				warnings = append(warnings, fmt.Sprintf("%s includes missing header \"%s\"", 
+					filepath.Base(source), match[1]))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// Passes a warning to the warning callback (if set)
+func warn (meta Metadata, warning string) {
+	warn_lock.Lock()
+	defer warn_lock.Unlock()
+	if nil != meta.Warn {
+		meta.Warn(warning)
+	}
+}
+
+// Returns true if an include directive names the header (by base name)
+func header_included (header string, includes []string) bool {
+	for _, include := range includes {
+		_, path, _ := split_include(include)
+		if path == header || strings.HasSuffix(path, "/" + header) {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits an include into its delimiters ("<" and ">", quotes, or none) and path. 
+// Includes are written with or without delimiters (e.g. <rclcpp/rclcpp.hpp>, 
+// "foo.hpp", or std_msgs/msg/string.hpp)
+func split_include (include string) (string, string, string) {
+	include = strings.TrimSpace(include)
+	if len(include) >= 2 {
+		open, close := include[:1], include[len(include) - 1:]
+		if (open == "<" && close == ">") || (open == "\"" && close == "\"") {
+			return open, include[1:len(include) - 1], close
+		}
+	}
+	return "", include, ""
+}
+
+// Returns the strings without duplicates, preserving the order of first occurrence
+func unique_strings (ss []string) []string {
+	unique, seen := []string{}, map[string]bool{}
+	for _, s := range ss {
+		if !seen[s] {
+			seen[s] = true
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// Returns true if the file (in the OS) and destination (in the filesystem) have 
+// the same size and content hash. A missing destination is never identical
+func identical_files (from, to string, fs FileSystem) (bool, error) {
+	info_from, err := os.Stat(from)
+	if nil != err {
+		return false, err
+	}
+	info_to, err := fs.Stat(to)
+	if nil != err || nil == info_to || info_to.Size() != info_from.Size() {
+		return false, nil
+	}
+
+	// Closure: Hashes the content of a reader
+	hash := func (r io.ReadCloser) ([]byte, error) {
+		defer r.Close()
+		h := sha256.New()
+		_, err := io.Copy(h, r)
+		return h.Sum(nil), err
+	}
+
+	file_from, err := os.Open(from)
+	if nil != err {
+		return false, err
+	}
+	hash_from, err := hash(file_from)
+	if nil != err {
+		return false, err
+	}
+	file_to, err := fs.Open(to)
+	if nil != err {
+		return false, err
+	}
+	hash_to, err := hash(file_to)
+	if nil != err {
+		return false, err
+	}
+	return bytes.Equal(hash_from, hash_to), nil
+}
+
+// Returns the filesystem to write to
+func filesystem (meta Metadata) FileSystem {
+	if nil == meta.Filesystem {
+		return os_filesystem{}
+	}
+	return meta.Filesystem
+}
+
+// Writes data to a file in the filesystem
+func write_file (fs FileSystem, path string, data []byte) error {
+	w, err := fs.Create(path)
+	if nil != err {
+		return err
+	}
+	_, err = w.Write(data)
+	if nil != err {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Reads a file from the filesystem
+func read_file (fs FileSystem, path string) ([]byte, error) {
+	r, err := fs.Open(path)
+	if nil != err {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Makes a file executable (if the filesystem supports modes)
+func make_executable (fs FileSystem, path string) error {
+	if c, ok := fs.(interface{ Chmod(string, os.FileMode) error }); ok {
+		return c.Chmod(path, 0777)
+	}
+	return nil
+}
+
 func exists_file_or_directory (path string) bool {
 	_, err := os.Stat(path)
 	return !os.IsNotExist(err)
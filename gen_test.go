@@ -0,0 +1,584 @@
+package gen
+
+import (
+
+	// Standard packages
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	// Custom packages
+	"app"
+	"graph"
+)
+
+/*
+ *******************************************************************************
+ *                             Fake Command Setup                              *
+ *******************************************************************************
+*/
+
+// Replaces command lookup and construction with TestHelperProcess, which records
+// each invocation in the returned log file. Commands named in 'missing' are not
+// found. The originals are restored when the test ends
+func fake_commands (t *testing.T, missing ...string) string {
+	log_path := filepath.Join(t.TempDir(), "commands.log")
+	original_look_path, original_exec_command := look_path, exec_command
+	t.Cleanup(func () {
+		look_path, exec_command = original_look_path, original_exec_command
+	})
+
+	look_path = func (name string) (string, error) {
+		for _, m := range missing {
+			if name == m {
+				return "", exec.ErrNotFound
+			}
+		}
+		return "/fake/" + name, nil
+	}
+	exec_command = func (name string, args ...string) *exec.Cmd {
+		cmd := exec.Command(os.Args[0], append([]string{"-test.run=TestHelperProcess",
+			"--", name}, args...)...)
+		cmd.Env = append(os.Environ(), "GEN_HELPER_PROCESS=1", "GEN_HELPER_LOG=" + log_path)
+		return cmd
+	}
+	return log_path
+}
+
+// Not a test: runs as the fake command. It logs its name, arguments, and input,
+// echoes them to stdout, and fails if its first argument is "fail"
+func TestHelperProcess (t *testing.T) {
+	if os.Getenv("GEN_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
+	}
+	args = args[1:]
+	input, _ := ioutil.ReadAll(os.Stdin)
+	record := strings.Join(args, " ") + "\n" + string(input)
+
+	log_file, err := os.OpenFile(os.Getenv("GEN_HELPER_LOG"),
+		os.O_CREATE | os.O_APPEND | os.O_WRONLY, 0666)
+	if nil == err {
+		log_file.WriteString(record)
+		log_file.Close()
+	}
+	fmt.Print(record)
+
+	if len(args) > 1 && args[1] == "fail" {
+		fmt.Fprintln(os.Stderr, "failed on request")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// Writes a template file into a temporary directory, and returns its path
+func write_template (t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := ioutil.WriteFile(path, []byte(content), 0666)
+	if nil != err {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Writes the templates of an application without executors into a temporary 
+// directory, and returns it
+func write_application_templates (t *testing.T) string {
+	template_dir := t.TempDir()
+	templates := map[string]string{"CMakeLists.tmpl": "version 0", "package.tmpl": "<package/>",
+		"launch.tmpl": "launch", "graph.dt": "digraph {}", "application.dt": "digraph {}"}
+	for name, content := range templates {
+		err := ioutil.WriteFile(filepath.Join(template_dir, name), []byte(content), 0666)
+		if nil != err {
+			t.Fatal(err)
+		}
+	}
+	return template_dir
+}
+
+/*
+ *******************************************************************************
+ *                                Command Tests                                *
+ *******************************************************************************
+*/
+
+func TestGenerateWithCommandArguments (t *testing.T) {
+	log_path := fake_commands(t)
+	template_path := write_template(t, "input.tmpl", "hello {{.}}")
+
+	err := GenerateWithCommand(template_path, "tool", []string{"-a", "b"}, "world")
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	log, err := ioutil.ReadFile(log_path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if expected := "tool -a b\nhello world"; string(log) != expected {
+		t.Errorf("command log = %q, expected %q", string(log), expected)
+	}
+}
+
+func TestGenerateWithCommandNotFound (t *testing.T) {
+	fake_commands(t, "tool")
+	template_path := write_template(t, "input.tmpl", "hello")
+
+	err := GenerateWithCommand(template_path, "tool", []string{}, "data")
+	if !errors.Is(err, ErrCommandNotFound) {
+		t.Errorf("error = %v, expected ErrCommandNotFound", err)
+	}
+	if errors.Is(err, ErrCommandFailed) {
+		t.Errorf("error = %v, should not be ErrCommandFailed", err)
+	}
+}
+
+func TestGenerateWithCommandFailed (t *testing.T) {
+	fake_commands(t)
+	template_path := write_template(t, "input.tmpl", "hello")
+
+	err := GenerateWithCommand(template_path, "tool", []string{"fail"}, "data")
+	if !errors.Is(err, ErrCommandFailed) {
+		t.Fatalf("error = %v, expected ErrCommandFailed", err)
+	}
+	if !strings.Contains(err.Error(), "failed on request") {
+		t.Errorf("error = %v, expected the command output", err)
+	}
+}
+
+func TestExecuteWithCommandDelimiters (t *testing.T) {
+	log_path := fake_commands(t)
+	template_path := write_template(t, "input.tmpl", "{{literal}} [[.]]")
+
+	parsed, err := ParseTemplate(template_path, [2]string{"[[", "]]"})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = ExecuteWithCommand(parsed, "tool", []string{}, "world")
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	log, err := ioutil.ReadFile(log_path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if expected := "tool\n{{literal}} world"; string(log) != expected {
+		t.Errorf("command log = %q, expected %q", string(log), expected)
+	}
+}
+
+func TestGenerateDelimiters (t *testing.T) {
+	log_path := fake_commands(t)
+	template_path := write_template(t, "input.tmpl", "{{literal}} [[.]]")
+	delimiters := [2]string{"[[", "]]"}
+
+	err := GenerateWithCommand(template_path, "tool", []string{}, "world", delimiters)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	log, _ := ioutil.ReadFile(log_path)
+	if expected := "tool\n{{literal}} world"; string(log) != expected {
+		t.Errorf("command log = %q, expected %q", string(log), expected)
+	}
+
+	out_path := filepath.Join(t.TempDir(), "out.txt")
+	err = GenerateTemplate("world", template_path, out_path, delimiters)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output, _ := ioutil.ReadFile(out_path)
+	if expected := "{{literal}} world"; string(output) != expected {
+		t.Errorf("output = %q, expected %q", string(output), expected)
+	}
+
+	fields, err := TemplateFields(write_template(t, "fields.tmpl", "{{x}} [[.Name]]"), delimiters)
+	if nil != err || len(fields) != 1 || fields[0] != ".Name" {
+		t.Errorf("fields = %v (error %v), expected [.Name]", fields, err)
+	}
+}
+
+func TestRunDotArguments (t *testing.T) {
+	fake_commands(t)
+
+	output, err := run_dot("png", "digraph {}", Metadata{Extra_dot_args: []string{"-Gdpi=72"}})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "dot -Tpng -Gdpi=72\ndigraph {}"; string(output) != expected {
+		t.Errorf("dot output = %q, expected %q", string(output), expected)
+	}
+}
+
+/*
+ *******************************************************************************
+ *                                Region Tests                                 *
+ *******************************************************************************
+*/
+
+func TestGenerateRegionXML (t *testing.T) {
+	template_path := write_template(t, "package.tmpl",
+		"<?xml version=\"1.0\"?>\n<package format=\"3\">\n  <name>{{.}}</name>\n</package>\n")
+	out_path := filepath.Join(t.TempDir(), "package.xml")
+	begin, end := "<!-- BEGIN GEN -->", "<!-- END GEN -->"
+
+	// A new file keeps the markers inside the root element
+	err := generate_region("a", template_path, out_path, begin, end, true, Metadata{})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := "<?xml version=\"1.0\"?>\n<package format=\"3\">\n" + begin +
+		"\n  <name>a</name>\n" + end + "\n</package>\n"
+	output, _ := ioutil.ReadFile(out_path)
+	if string(output) != expected {
+		t.Fatalf("new file = %q, expected %q", string(output), expected)
+	}
+
+	// Regeneration replaces the region and keeps hand-written content
+	edited := strings.Replace(expected, "</package>", "  <license>MIT</license>\n</package>", 1)
+	ioutil.WriteFile(out_path, []byte(edited), 0666)
+	err = generate_region("b", template_path, out_path, begin, end, true, Metadata{})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	output, _ = ioutil.ReadFile(out_path)
+	if string(output) != strings.Replace(edited, ">a<", ">b<", 1) {
+		t.Errorf("regenerated file = %q", string(output))
+	}
+
+	// An existing file without markers gets the region before its closing tag
+	ioutil.WriteFile(out_path, []byte("<package>\n  <license>MIT</license>\n</package>\n"), 0666)
+	err = generate_region("c", template_path, out_path, begin, end, true, Metadata{})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = "<package>\n  <license>MIT</license>\n" + begin + "\n  <name>c</name>\n" + end +
+		"\n</package>\n"
+	output, _ = ioutil.ReadFile(out_path)
+	if string(output) != expected {
+		t.Errorf("merged file = %q, expected %q", string(output), expected)
+	}
+}
+
+/*
+ *******************************************************************************
+ *                                 Field Tests                                 *
+ *******************************************************************************
+*/
+
+func TestTemplateFieldsContext (t *testing.T) {
+	template_path := write_template(t, "fields.tmpl", `{{.Name}}
+{{range .Executors}}{{.Source}}{{$.Package}}{{end}}
+{{with .Build}}{{.Flags}}{{end}}
+{{define "callback"}}{{.Id}}{{template "callback" .}}{{end}}
+{{template "callback" .First}}
+{{range $i, $e := .Items}}{{$e.Hidden}}{{end}}`)
+
+	fields, err := TemplateFields(template_path)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{".Build", ".Build.Flags", ".Executors", ".Executors[].Source", 
+		".First", ".First.Id", ".Items", ".Name", ".Package"}
+	if strings.Join(fields, " ") != strings.Join(expected, " ") {
+		t.Errorf("fields = %v, expected %v", fields, expected)
+	}
+}
+
+func TestRenderFileDelimiters (t *testing.T) {
+	template_path := write_template(t, "file.tmpl", "{{ keep }} <<.>>")
+
+	output, err := render_file("data", template_path, "CMakeLists.txt",
+		Metadata{Delimiters: [2]string{"<<", ">>"}})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "{{ keep }} data"; output != expected {
+		t.Errorf("output = %q, expected %q", output, expected)
+	}
+}
+
+func TestRenderFileHeader (t *testing.T) {
+	meta := Metadata{File_header: "SPDX-License-Identifier: MIT\n"}
+
+	for _, c := range []struct{ out_path, content, expected string }{
+		{"src/exec.cpp", "body", "// SPDX-License-Identifier: MIT\nbody"},
+		{"include/exec.hpp", "body", "// SPDX-License-Identifier: MIT\nbody"},
+		{"CMakeLists.txt", "body", "# SPDX-License-Identifier: MIT\nbody"},
+		{"launch/pkg_launch.py", "body", "# SPDX-License-Identifier: MIT\nbody"},
+		{"build.sh", "#!/bin/sh\nbody", "#!/bin/sh\n# SPDX-License-Identifier: MIT\nbody"},
+		{"package.xml", "<?xml version=\"1.0\"?>\n<package/>",
+			"<?xml version=\"1.0\"?>\n<!-- SPDX-License-Identifier: MIT -->\n<package/>"},
+		{"notes.md", "body", "body"},
+	} {
+		var warnings []string
+		meta.Warn = func (w string) { warnings = append(warnings, w) }
+		output, err := render_file("data", write_template(t, "file.tmpl", c.content), 
+			c.out_path, meta)
+		if nil != err {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if output != c.expected {
+			t.Errorf("%s = %q, expected %q", c.out_path, output, c.expected)
+		}
+		if (c.out_path == "notes.md") != (len(warnings) == 1) {
+			t.Errorf("%s: warnings = %v", c.out_path, warnings)
+		}
+	}
+}
+
+/*
+ *******************************************************************************
+ *                              Output Path Tests                              *
+ *******************************************************************************
+*/
+
+func TestGenerateTemplateBesideTemplate (t *testing.T) {
+	template_path := write_template(t, "input.tmpl", "hello")
+
+	// Standalone generation has no template dir, only the template itself
+	out_path := filepath.Join(filepath.Dir(template_path), "out.txt")
+	if err := GenerateTemplate("data", template_path, out_path); nil != err {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := GenerateTemplate("data", template_path, template_path); nil == err {
+		t.Errorf("expected an error when overwriting the template")
+	}
+}
+
+func TestGenerateFileIntoTemplateDir (t *testing.T) {
+	template_path := write_template(t, "input.tmpl", "hello")
+	link := filepath.Join(t.TempDir(), "link")
+	err := os.Symlink(filepath.Dir(template_path), link)
+	if nil != err {
+		t.Skip("symbolic links unavailable: ", err)
+	}
+
+	// Directly, and through a link to the template directory
+	for _, out_path := range []string{filepath.Join(filepath.Dir(template_path), "out.txt"),
+		filepath.Join(link, "out.txt"), filepath.Join(link, "input.tmpl")} {
+		err = generate_file("data", template_path, out_path, Metadata{})
+		if nil == err || !strings.Contains(err.Error(), "template dir") {
+			t.Errorf("%s: error = %v, expected a template dir error", out_path, err)
+		}
+	}
+	if err := generate_file("data", template_path, filepath.Join(t.TempDir(), "out.txt"),
+		Metadata{}); nil != err {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+/*
+ *******************************************************************************
+ *                               Metadata Tests                                *
+ *******************************************************************************
+*/
+
+func TestMetadataWarnings (t *testing.T) {
+	meta := Metadata{
+		Headers:           []string{"lib/used.hpp", "lib/other.h", "lib/unused.hpp"},
+		Includes:          []string{"used.hpp"},
+		Executor_includes: map[int][]string{1: {"<pkg/other.h>"}},
+		Graph_style:       Graphstyle{Caption: "today", Critical_color: "blue"},
+		Linter_command:    []string{"cpplint"},
+		Graph_renderer:    Mermaid_renderer{},
+		Keep_dot:          true,
+	}
+	warnings := strings.Join(MetadataWarnings(meta), "\n")
+	for _, expected := range []string{"Header lib/unused.hpp", "Caption", "Critical_color",
+		"Linter_command", "Keep_dot"} {
+		if !strings.Contains(warnings, expected) {
+			t.Errorf("warnings %q do not mention %s", warnings, expected)
+		}
+	}
+	for _, unexpected := range []string{"lib/used.hpp", "other.h", "Subgraph_root", "Keep_plain"} {
+		if strings.Contains(warnings, unexpected) {
+			t.Errorf("warnings %q should not mention %s", warnings, unexpected)
+		}
+	}
+	if warnings := MetadataWarnings(Metadata{}); len(warnings) != 0 {
+		t.Errorf("default metadata warnings = %v", warnings)
+	}
+
+	// Linter output only reaches the caller through Warn
+	lint := Metadata{Run_linters: true}
+	if warnings := strings.Join(MetadataWarnings(lint), "\n"); !strings.Contains(warnings,
+		"Run_linters") {
+		t.Errorf("warnings %q do not mention Run_linters", warnings)
+	}
+	lint.Warn = func(string) {}
+	if warnings := MetadataWarnings(lint); len(warnings) != 0 {
+		t.Errorf("linter warnings with Warn set = %v", warnings)
+	}
+}
+
+func TestCheckApplicationFilterArity (t *testing.T) {
+	a := &app.Application{Name: "pkg", Executors: []app.Executor{{}, {}}}
+
+	err := check_application(a, Metadata{Filter_arity: map[int]int{0: 2, 1: 0}})
+	if nil == err || !strings.Contains(err.Error(), "executor 1") {
+		t.Errorf("error = %v, expected an arity error for executor 1", err)
+	}
+	if err := check_application(a, Metadata{Filter_arity: map[int]int{1: 3}}); nil != err {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRunLinterOutput (t *testing.T) {
+	fake_commands(t)
+
+	output, err := run_linter("pkg", Metadata{Linter_command: []string{"lint", "--quiet"}})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := "lint --quiet pkg"; output != expected {
+		t.Errorf("output = %q, expected %q", output, expected)
+	}
+
+	_, err = run_linter("pkg", Metadata{Linter_command: []string{"lint", "fail"}})
+	if !errors.Is(err, ErrCommandFailed) {
+		t.Errorf("error = %v, expected ErrCommandFailed", err)
+	}
+}
+
+/*
+ *******************************************************************************
+ *                               Renderer Tests                                *
+ *******************************************************************************
+*/
+
+func TestGenerateApplicationRenderers (t *testing.T) {
+	a, graph_data := &app.Application{Name: "pkg"}, Graphdata{Graph: &graph.Graph{}}
+
+	// Mermaid renders both graphs, without dot
+	fake_commands(t, "dot")
+	path := t.TempDir()
+	meta := Metadata{Template_dir: write_application_templates(t), Allow_empty: true,
+		Graph_renderer: Mermaid_renderer{}}
+	if err := GenerateApplication(a, path, meta, graph_data); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"graph.mmd", "application.mmd"} {
+		if _, err := os.Stat(filepath.Join(path, "pkg", "assets", name)); nil != err {
+			t.Errorf("missing %s: %v", name, err)
+		}
+	}
+
+	// The default renderer uses dot, and keeps the DOT sources if requested
+	fake_commands(t)
+	path = t.TempDir()
+	meta.Graph_renderer, meta.Keep_dot = nil, true
+	if err := GenerateApplication(a, path, meta, graph_data); nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, name := range []string{"graph.png", "graph.dot", "application.png", 
+		"application.dot"} {
+		if _, err := os.Stat(filepath.Join(path, "pkg", "assets", name)); nil != err {
+			t.Errorf("missing %s: %v", name, err)
+		}
+	}
+}
+
+func TestBuildHookCopiesMetadata (t *testing.T) {
+	meta := Metadata{Packages: []string{"b", "a"}, Warning_flags: []string{"-Wall"},
+		Compile_definitions: []string{"X"}, Test_packages: []string{"t"}}
+	meta.Build_hook = func (b *Build) error {
+		sort.Strings(b.Packages)
+		for _, s := range [][]string{b.Build_depends, b.Warning_flags, b.Compile_definitions,
+			b.Test_depends} {
+			s[0] = "changed"
+		}
+		return nil
+	}
+
+	_, err := application_build(&app.Application{Name: "pkg"}, meta, Graphdata{})
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Packages[0] != "b" || meta.Warning_flags[0] != "-Wall" ||
+		meta.Compile_definitions[0] != "X" || meta.Test_packages[0] != "t" {
+		t.Errorf("build hook modified the metadata: %+v", meta)
+	}
+}
+
+/*
+ *******************************************************************************
+ *                                Include Tests                                *
+ *******************************************************************************
+*/
+
+func TestDerivePackagesIncludeFormats (t *testing.T) {
+	executors := []ROS_Executor{{Includes: []string{"<std_msgs/msg/string.hpp>",
+		"\"rclcpp/rclcpp.hpp\"", "sensor_msgs/msg/image.hpp", "<pkg/local.hpp>", "<vector>"}}}
+
+	packages := derive_packages(&app.Application{Name: "pkg"}, Metadata{}, executors)
+	expected := []string{"std_msgs", "rclcpp", "sensor_msgs"}
+	if strings.Join(packages, " ") != strings.Join(expected, " ") {
+		t.Errorf("packages = %v, expected %v", packages, expected)
+	}
+}
+
+func TestSortIncludesFormats (t *testing.T) {
+	sorted := sort_includes("pkg", []string{"\"local.hpp\"", "<pkg/own.hpp>", "<vector>",
+		"rclcpp/rclcpp.hpp"})
+	expected := []string{"<vector>", "rclcpp/rclcpp.hpp", "\"local.hpp\"", "<pkg/own.hpp>"}
+	if strings.Join(sorted, " ") != strings.Join(expected, " ") {
+		t.Errorf("sorted = %v, expected %v", sorted, expected)
+	}
+}
+
+func TestPackageIncludesFormats (t *testing.T) {
+	meta := Metadata{Package_includes: true, Headers: []string{"lib/foo.hpp"}}
+
+	rewritten := package_includes("pkg", []string{"\"foo.hpp\"", "<foo.hpp>", "foo.hpp",
+		"<vector>"}, meta)
+	expected := []string{"\"pkg/foo.hpp\"", "<pkg/foo.hpp>", "pkg/foo.hpp", "<vector>"}
+	if strings.Join(rewritten, " ") != strings.Join(expected, " ") {
+		t.Errorf("rewritten = %v, expected %v", rewritten, expected)
+	}
+}
+
+/*
+ *******************************************************************************
+ *                                 Size Tests                                  *
+ *******************************************************************************
+*/
+
+func TestEstimateSizeMatchesTree (t *testing.T) {
+	a, graph_data := &app.Application{Name: "pkg"}, Graphdata{Graph: &graph.Graph{}}
+	meta := Metadata{Template_dir: write_application_templates(t), Allow_empty: true,
+		Priorities_report: true, Node_map: true}
+
+	size, err := EstimateSize(a, meta, graph_data)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tree, err := BuildApplicationTree(a, meta, graph_data)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The tree additionally holds the DOT sources of the graphs
+	var expected int64 = 0
+	for path, content := range tree {
+		if !strings.HasSuffix(path, ".dot") {
+			expected += int64(len(content))
+		}
+	}
+	if size != expected {
+		t.Errorf("size = %d, expected %d", size, expected)
+	}
+
+	if _, err := EstimateSize(a, Metadata{Allow_empty: true}, graph_data); nil == err {
+		t.Errorf("expected an error without a template dir")
+	}
+}
@@ -0,0 +1,105 @@
+package gen
+
+import (
+
+	// Standard packages
+	"encoding/json"
+	"errors"
+
+	// Custom packages
+	"app"
+	"ops"
+	"graph"
+)
+
+/*
+ *******************************************************************************
+ *                            JSON Type Definitions                            *
+ *******************************************************************************
+*/
+
+type Json_application struct {
+	Name      string                 `json:"name"`      // Application name
+	Executors []Json_executor        `json:"executors"` // Executors, by index
+	Nodes     []Json_node            `json:"nodes"`     // All graph nodes
+	Edges     []Json_edge            `json:"edges"`     // All graph edges
+	Chains    []Json_chain           `json:"chains"`    // Chains, by index
+}
+
+type Json_executor struct {
+	Index     int                    `json:"index"`     // Executor index
+	Nodes     []int                  `json:"nodes"`     // Nodes (callbacks) hosted
+}
+
+type Json_node struct {
+	Id        int                    `json:"id"`        // Node ID
+	Chain     int                    `json:"chain"`     // Chain index (-1: SYNC node)
+	Sync      bool                   `json:"sync"`      // Whether it is a SYNC node
+	Wcet_us   int64                  `json:"wcet_us"`   // WCET (us)
+	Priority  int                    `json:"priority"`  // Priority
+}
+
+type Json_edge struct {
+	From      int                    `json:"from"`      // Source node
+	To        int                    `json:"to"`        // Destination node
+	Tag       int                    `json:"tag"`       // Edge tag
+	Num       int                    `json:"num"`       // Edge number
+	Color     string                 `json:"color"`     // Edge color
+}
+
+type Json_chain struct {
+	Index     int                    `json:"index"`     // Chain index
+	Nodes     []int                  `json:"nodes"`     // Nodes in the chain
+}
+
+/*
+ *******************************************************************************
+ *                         Public Function Definitions                         *
+ *******************************************************************************
+*/
+
+// Serializes the application structure as JSON (see Json_application for the schema)
+func ApplicationToJSON (a *app.Application, g *graph.Graph, graph_data Graphdata) ([]byte, error) {
+
+	// Check: valid input
+	if nil == a || nil == g {
+		return nil, errors.New("bad argument: null pointer")
+	}
+
+	j := Json_application{Name: a.Name, Executors: []Json_executor{}, Nodes: []Json_node{},
+		Edges: []Json_edge{}, Chains: []Json_chain{}}
+
+	// Executors
+	for i, exec := range a.Executors {
+		j.Executors = append(j.Executors, Json_executor{Index: i, Nodes: executor_nodes(exec)})
+	}
+
+	// Chains
+	for i := range graph_data.Chains {
+		j.Chains = append(j.Chains, Json_chain{Index: i, Nodes: []int{}})
+	}
+
+	// Nodes
+	n_chain_nodes := ops.NodeCount(graph_data.Chains)
+	for i := 0; i < g.Len(); i++ {
+		node := Json_node{Id: i, Chain: -1, Sync: true, Wcet_us: graph_data.Node_wcet_map[i],
+			Priority: graph_data.Node_prio_map[i]}
+		if i < n_chain_nodes {
+			node.Chain, node.Sync = ops.ChainForRow(i, graph_data.Chains), false
+			j.Chains[node.Chain].Nodes = append(j.Chains[node.Chain].Nodes, i)
+		}
+		j.Nodes = append(j.Nodes, node)
+	}
+
+	// Edges
+	for from := 0; from < g.Len(); from++ {
+		for to := 0; to < g.Len(); to++ {
+			for _, e := range ops.EdgesAt(from, to, g) {
+				j.Edges = append(j.Edges, Json_edge{From: from, To: to, Tag: e.Tag, Num: e.Num,
+					Color: e.Color})
+			}
+		}
+	}
+
+	return json.MarshalIndent(j, "", "  ")
+}
@@ -0,0 +1,135 @@
+package gen
+
+import (
+
+	// Standard packages
+	"errors"
+	"fmt"
+	"strings"
+
+	// Custom packages
+	"app"
+	"graph"
+)
+
+/*
+ *******************************************************************************
+ *                         Public Function Definitions                         *
+ *******************************************************************************
+*/
+
+// Converts the chain graph to a Mermaid flowchart
+func GraphToMermaid (graph_data Graphdata) (string, error) {
+
+	// Check: valid input
+	if nil == graph_data.Graph {
+		return "", errors.New("bad argument: null pointer")
+	}
+
+	g, err := graph_to_graphviz(graph_data, Graphstyle{})
+	if nil != err {
+		return "", err
+	}
+
+	return mermaid_graph(g), nil
+}
+
+// Converts the application graph to a Mermaid flowchart, grouping nodes by executor
+func ApplicationToMermaid (a *app.Application, g *graph.Graph) (string, error) {
+
+	// Check: valid input
+	if nil == a || nil == g {
+		return "", errors.New("bad argument: null pointer")
+	}
+
+	ga, err := application_to_graphviz(a, g, Graphstyle{})
+	if nil != err {
+		return "", err
+	}
+
+	return mermaid_application(ga), nil
+}
+
+/*
+ *******************************************************************************
+ *                          Private Mermaid Functions                          *
+ *******************************************************************************
+*/
+
+// Converts a graphviz graph to a Mermaid flowchart
+func mermaid_graph (g Graphviz_graph) string {
+	var b strings.Builder
+
+	b.WriteString("flowchart TD\n")
+	for _, n := range g.Nodes {
+		open, close := "[", "]"
+		switch n.Shape {
+		case "circle":
+			open, close = "((", "))"
+		case "diamond":
+			open, close = "{", "}"
+		}
+		fmt.Fprintf(&b, "    N%d%s\"%s\"%s\n", n.Id, open, mermaid_text(n.Label), close)
+	}
+	write_mermaid_links(&b, g.Links, g.Undirected)
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    style N%d fill:%s\n", n.Id, n.Fill)
+	}
+
+	return b.String()
+}
+
+// Converts a graphviz application graph to a Mermaid flowchart, grouping nodes 
+// by executor
+func mermaid_application (ga Graphviz_application) string {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+	for i, exec := range ga.App.Executors {
+		fmt.Fprintf(&b, "    subgraph E%d[\"Executor %d\"]\n", i, i)
+		for _, id := range executor_nodes(exec) {
+			fmt.Fprintf(&b, "        N%d\n", id)
+		}
+		b.WriteString("    end\n")
+	}
+	write_mermaid_links(&b, ga.Links, ga.Undirected)
+
+	return b.String()
+}
+
+// Writes links as Mermaid edges, followed by their colors. Invisible links 
+// (ordering hints) are left out, dashed links are dotted, and undirected links
+// have no arrowhead
+func write_mermaid_links (b *strings.Builder, links []Link, undirected bool) {
+	colors := []string{}
+	for _, l := range links {
+		if l.Style == "invis" {
+			continue
+		}
+		dotted := l.Style == "dashed" || l.Style == "dotted"
+		edge := "-->"
+		switch {
+		case (undirected || l.Arrowhead == "none") && dotted:
+			edge = "-.-"
+		case undirected || l.Arrowhead == "none":
+			edge = "---"
+		case dotted:
+			edge = "-.->"
+		}
+		fmt.Fprintf(b, "    N%d %s|\"%s\"| N%d\n", l.From, edge, mermaid_text(l.Label), l.To)
+		colors = append(colors, l.Color)
+	}
+
+	// Link styles are indexed by the order in which links were written
+	for i, color := range colors {
+		if color != "" {
+			fmt.Fprintf(b, "    linkStyle %d stroke:%s\n", i, color)
+		}
+	}
+}
+
+// Escapes text for use in a quoted Mermaid label
+func mermaid_text (text string) string {
+	text = strings.ReplaceAll(text, "\"", "#quot;")
+	return strings.ReplaceAll(text, "\n", "<br/>")
+}
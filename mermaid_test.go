@@ -0,0 +1,38 @@
+package gen
+
+import (
+
+	// Standard packages
+	"strings"
+	"testing"
+)
+
+/*
+ *******************************************************************************
+ *                                Mermaid Tests                                *
+ *******************************************************************************
+*/
+
+func TestMermaidLinks (t *testing.T) {
+	links := []Link{
+		{From: 1, To: 2, Label: "a", Color: "red"},
+		{From: 2, To: 3, Style: "invis", Color: "blue"},
+		{From: 3, To: 4, Label: "b", Style: "dashed", Color: "green"},
+	}
+
+	// Invisible links are skipped, and styles index the links written
+	var b strings.Builder
+	write_mermaid_links(&b, links, false)
+	expected := "    N1 -->|\"a\"| N2\n    N3 -.->|\"b\"| N4\n" + 
+		"    linkStyle 0 stroke:red\n    linkStyle 1 stroke:green\n"
+	if b.String() != expected {
+		t.Errorf("directed links = %q, expected %q", b.String(), expected)
+	}
+
+	// Undirected links have no arrowheads
+	b.Reset()
+	write_mermaid_links(&b, links[:1], true)
+	if expected := "    N1 ---|\"a\"| N2\n    linkStyle 0 stroke:red\n"; b.String() != expected {
+		t.Errorf("undirected links = %q, expected %q", b.String(), expected)
+	}
+}
@@ -0,0 +1,177 @@
+package gen
+
+import (
+
+	// Standard packages
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+ *******************************************************************************
+ *                          Renderer Type Definitions                          *
+ *******************************************************************************
+*/
+
+// Renders chain graphs into some diagram format. A renderer may also implement
+// Extension() string, naming the extension of its output (default: png), and
+// RenderApplication(Graphviz_application, io.Writer) error, to also render the
+// application graph (which is otherwise not rendered)
+type GraphRenderer interface {
+	Render(g Graphviz_graph, out io.Writer) error
+}
+
+// Renders graphs to PNG images with dot. During generation, the Keep_dot,
+// Keep_plain, and Png_optimizer options apply, and unset templates default to
+// graph.dt and application.dt in the template directory
+type Graphviz_renderer struct {
+	Template  string                 // Path to the chain graph DOT template (e.g. graph.dt)
+	Application_template string      // Path to the application graph DOT template
+	Args      []string               // Additional arguments passed to dot
+	Delimiters [2]string             // Template action delimiters (empty: "{{" and "}}")
+}
+
+// Renders graphs to Mermaid flowcharts
+type Mermaid_renderer struct{}
+
+// Renderer of application graphs (see GraphRenderer)
+type application_renderer interface {
+	RenderApplication(ga Graphviz_application, out io.Writer) error
+}
+
+/*
+ *******************************************************************************
+ *                         Renderer Method Definitions                         *
+ *******************************************************************************
+*/
+
+func (r Graphviz_renderer) Render (g Graphviz_graph, out io.Writer) error {
+	return r.render(g, r.Template, out)
+}
+
+func (r Graphviz_renderer) RenderApplication (ga Graphviz_application, out io.Writer) error {
+	return r.render(ga, r.Application_template, out)
+}
+
+func (r Graphviz_renderer) Extension () string {
+	return "png"
+}
+
+// Renders the DOT template with the data as a PNG image into the writer
+func (r Graphviz_renderer) render (data interface{}, template_path string,
+	out io.Writer) error {
+
+	// Check: template configured
+	if template_path == "" {
+		return errors.New("bad argument: no DOT template configured")
+	}
+
+	// Render the DOT source, then the image
+	dot, err := render_dot(data, template_path, r.options(Metadata{}))
+	if nil != err {
+		return err
+	}
+	image, err := run_dot("png", dot, r.options(Metadata{}))
+	if nil != err {
+		return err
+	}
+	_, err = out.Write(image)
+	return err
+}
+
+// Returns the metadata with the dot arguments and delimiters of the renderer
+func (r Graphviz_renderer) options (meta Metadata) Metadata {
+	meta.Extra_dot_args = append(append([]string{}, meta.Extra_dot_args...), r.Args...)
+	if r.Delimiters != [2]string{} {
+		meta.Delimiters = r.Delimiters
+	}
+	return meta
+}
+
+func (r Mermaid_renderer) Render (g Graphviz_graph, out io.Writer) error {
+	_, err := io.WriteString(out, mermaid_graph(g))
+	return err
+}
+
+func (r Mermaid_renderer) RenderApplication (ga Graphviz_application, out io.Writer) error {
+	_, err := io.WriteString(out, mermaid_application(ga))
+	return err
+}
+
+func (r Mermaid_renderer) Extension () string {
+	return "mmd"
+}
+
+/*
+ *******************************************************************************
+ *                         Private Renderer Functions                          *
+ *******************************************************************************
+*/
+
+// Returns the renderer used during generation: the configured one, or dot with
+// the graph templates of the template directory
+func graph_renderer (meta Metadata, template_dir string) GraphRenderer {
+	renderer := meta.Graph_renderer
+	if nil == renderer {
+		renderer = Graphviz_renderer{}
+	}
+	if r, ok := renderer.(Graphviz_renderer); ok {
+		if r.Template == "" {
+			r.Template = template_dir + "/" + template_name("graph.dt", meta)
+		}
+		if r.Application_template == "" {
+			r.Application_template = template_dir + "/" + template_name("application.dt", meta)
+		}
+		renderer = r
+	}
+	return renderer
+}
+
+// Renders a chain graph (Graphviz_graph) or application graph (Graphviz_application)
+// with a renderer into '<out_path>.<extension>' in the filesystem. Rendering with
+// dot also applies the Keep_dot, Keep_plain, and Png_optimizer options
+func render_with (renderer GraphRenderer, data interface{}, out_path string,
+	meta Metadata) error {
+	var extension string = "png"
+
+	// Check: valid input
+	if nil == renderer {
+		return errors.New("bad argument: null pointer")
+	}
+
+	if r, ok := renderer.(Graphviz_renderer); ok {
+		template_path := r.Template
+		if _, ok := data.(Graphviz_application); ok {
+			template_path = r.Application_template
+		}
+		return render_graph(data, template_path, out_path, r.options(meta))
+	}
+
+	if e, ok := renderer.(interface{ Extension() string }); ok {
+		extension = e.Extension()
+	}
+
+	w, err := filesystem(meta).Create(out_path + "." + extension)
+	if nil != err {
+		return err
+	}
+	switch d := data.(type) {
+	case Graphviz_graph:
+		err = renderer.Render(d, w)
+	case Graphviz_application:
+		r, ok := renderer.(application_renderer)
+		if !ok {
+			err = errors.New("renderer cannot render application graphs")
+			break
+		}
+		err = r.RenderApplication(d, w)
+	default:
+		err = fmt.Errorf("bad argument: cannot render %T", data)
+	}
+	if nil != err {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,153 @@
+package gen
+
+import (
+
+	// Standard packages
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	// Third party packages
+	"gopkg.in/yaml.v2"
+
+	// Custom packages
+	"app"
+	"graph"
+)
+
+/*
+ *******************************************************************************
+ *                            YAML Type Definitions                            *
+ *******************************************************************************
+*/
+
+// Specification of an application, its metadata, and its graph, as read by
+// LoadSpec. Metadata keys are the lowercased field names (functions and
+// interfaces cannot be set). For example:
+//
+//	name: demo
+//	executors:
+//	  - callbacks: [{id: 0, priority: 2}, {id: 1, priority: 1}]
+//	  - callbacks: [{id: 2, priority: 1}]
+//	metadata:
+//	  msgtype: std_msgs::msg::Int32
+//	  packages: [std_msgs]
+//	graph:
+//	  nodes: 3
+//	  chains: [2, 1]
+//	  wcet_us: {0: 100, 1: 250, 2: 50}
+//	  priorities: {0: 2, 1: 1, 2: 1}
+//	  edges:
+//	    - {from: 0, to: 1, tag: 0}
+type Yaml_spec struct {
+	Name      string                 `yaml:"name"`      // Application name
+	Executors []Yaml_executor        `yaml:"executors"` // Executors, by index
+	Metadata  Metadata               `yaml:"metadata"`  // Generation metadata
+	Graph     Yaml_graph             `yaml:"graph"`     // Graph and timing data
+}
+
+type Yaml_executor struct {
+	Callbacks []Yaml_callback        `yaml:"callbacks"` // Callbacks (nodes) hosted
+}
+
+type Yaml_callback struct {
+	Id        int                    `yaml:"id"`        // Node ID
+	Priority  int                    `yaml:"priority"`  // Callback priority
+}
+
+type Yaml_graph struct {
+	Nodes     int                    `yaml:"nodes"`     // Node count (default: sum of chains)
+	Chains    []int                  `yaml:"chains"`    // Chain lengths, by index
+	Wcet_us   map[int]int64          `yaml:"wcet_us"`   // Mapping from node to WCET (us)
+	Priorities map[int]int           `yaml:"priorities"` // Mapping from node to priority
+	Edges     []Yaml_edge            `yaml:"edges"`     // Edges (repeat for multi-edges)
+}
+
+type Yaml_edge struct {
+	From      int                    `yaml:"from"`      // Source node
+	To        int                    `yaml:"to"`        // Destination node
+	Tag       int                    `yaml:"tag"`       // Edge tag
+}
+
+/*
+ *******************************************************************************
+ *                         Public Function Definitions                         *
+ *******************************************************************************
+*/
+
+// Reads an application, its metadata, and its graph from the YAML specification
+// at 'path' (see Yaml_spec for the schema)
+func LoadSpec (path string) (*app.Application, Metadata, Graphdata, error) {
+	var spec Yaml_spec
+
+	// Read and decode the specification (unknown keys are errors)
+	buffer, err := ioutil.ReadFile(path)
+	if nil != err {
+		return nil, Metadata{}, Graphdata{}, errors.New("Unable to read spec (" + path +
+			"): " + err.Error())
+	}
+	err = yaml.UnmarshalStrict(buffer, &spec)
+	if nil != err {
+		return nil, Metadata{}, Graphdata{}, errors.New("Unable to parse spec (" + path +
+			"): " + err.Error())
+	}
+
+	// Application
+	a := &app.Application{Name: spec.Name, Executors: []app.Executor{}}
+	for _, e := range spec.Executors {
+		exec := app.Executor{Callbacks: []app.Callback{}}
+		for _, c := range e.Callbacks {
+			exec.Callbacks = append(exec.Callbacks, app.Callback{Id: c.Id, Priority: c.Priority})
+		}
+		a.Executors = append(a.Executors, exec)
+	}
+
+	// Graph
+	g, err := spec_graph(spec.Graph)
+	if nil != err {
+		return nil, Metadata{}, Graphdata{}, errors.New("Invalid spec graph (" + path +
+			"): " + err.Error())
+	}
+	graph_data := Graphdata{Chains: spec.Graph.Chains, Node_wcet_map: spec.Graph.Wcet_us,
+		Node_prio_map: spec.Graph.Priorities, Graph: g}
+	if nil == graph_data.Chains {
+		graph_data.Chains = []int{}
+	}
+	if nil == graph_data.Node_wcet_map {
+		graph_data.Node_wcet_map = map[int]int64{}
+	}
+	if nil == graph_data.Node_prio_map {
+		graph_data.Node_prio_map = map[int]int{}
+	}
+
+	return a, spec.Metadata, graph_data, nil
+}
+
+/*
+ *******************************************************************************
+ *                           Private Spec Functions                            *
+ *******************************************************************************
+*/
+
+// Builds the graph of a specification, checking that edges reference its nodes
+func spec_graph (spec Yaml_graph) (*graph.Graph, error) {
+	n := spec.Nodes
+	if n == 0 {
+		for _, length := range spec.Chains {
+			n += length
+		}
+	}
+
+	g := graph.New(n)
+	for _, e := range spec.Edges {
+		if e.From < 0 || e.From >= n || e.To < 0 || e.To >= n {
+			return nil, fmt.Errorf("edge %d -> %d references a node outside [0, %d)",
+				e.From, e.To, n)
+		}
+		err := g.AddEdge(e.From, e.To, e.Tag)
+		if nil != err {
+			return nil, fmt.Errorf("edge %d -> %d: %s", e.From, e.To, err.Error())
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,83 @@
+package gen
+
+import (
+
+	// Standard packages
+	"strings"
+	"testing"
+
+	// Custom packages
+	"ops"
+)
+
+/*
+ *******************************************************************************
+ *                                 Spec Tests                                  *
+ *******************************************************************************
+*/
+
+func TestLoadSpec (t *testing.T) {
+	spec_path := write_template(t, "spec.yaml", `name: demo
+executors:
+  - callbacks: [{id: 0, priority: 2}, {id: 1, priority: 1}]
+  - callbacks: [{id: 2, priority: 1}]
+metadata:
+  msgtype: std_msgs::msg::Int32
+  packages: [std_msgs]
+  filter_arity: {1: 2}
+graph:
+  chains: [2, 1]
+  wcet_us: {0: 100, 1: 250}
+  priorities: {0: 2}
+  edges:
+    - {from: 0, to: 1, tag: 0}
+    - {from: 0, to: 1, tag: 1}
+    - {from: 1, to: 2}
+`)
+
+	a, meta, graph_data, err := LoadSpec(spec_path)
+	if nil != err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Application
+	if a.Name != "demo" || len(a.Executors) != 2 {
+		t.Fatalf("application = %+v", a)
+	}
+	if nodes := executor_nodes(a.Executors[0]); len(nodes) != 2 || nodes[1] != 1 {
+		t.Errorf("executor 0 nodes = %v, expected [0 1]", nodes)
+	}
+	if a.Executors[0].Callbacks[0].Priority != 2 {
+		t.Errorf("callback 0 priority = %d, expected 2", a.Executors[0].Callbacks[0].Priority)
+	}
+
+	// Metadata
+	if meta.MsgType != "std_msgs::msg::Int32" || len(meta.Packages) != 1 ||
+		meta.Filter_arity[1] != 2 {
+		t.Errorf("metadata = %+v", meta)
+	}
+
+	// Graph (node count derived from the chains)
+	if graph_data.Graph.Len() != 3 || len(graph_data.Chains) != 2 {
+		t.Fatalf("graph has %d nodes and chains %v", graph_data.Graph.Len(), graph_data.Chains)
+	}
+	if n := len(ops.EdgesAt(0, 1, graph_data.Graph)); n != 2 {
+		t.Errorf("edges 0 -> 1 = %d, expected 2", n)
+	}
+	if graph_data.Node_wcet_map[1] != 250 || graph_data.Node_prio_map[0] != 2 {
+		t.Errorf("graph data = %+v", graph_data)
+	}
+}
+
+func TestLoadSpecErrors (t *testing.T) {
+	for name, spec := range map[string]string{
+		"edge out of range": "name: demo\ngraph:\n  nodes: 2\n  edges: [{from: 0, to: 2}]\n",
+		"unknown key":       "name: demo\nexecutor: []\n",
+		"malformed":         "name: [demo\n",
+	} {
+		_, _, _, err := LoadSpec(write_template(t, "spec.yaml", spec))
+		if nil == err || !strings.Contains(err.Error(), "spec") {
+			t.Errorf("%s: error = %v, expected a spec error", name, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package gen
+
+import (
+
+	// Standard packages
+	"context"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	// Custom packages
+	"app"
+)
+
+// Interval at which the template directory is polled for changes
+var Watch_interval time.Duration = time.Second
+
+/*
+ *******************************************************************************
+ *                         Public Function Definitions                         *
+ *******************************************************************************
+*/
+
+// Generates the application, then regenerates it whenever a file in the template
+// directory changes (polling), until the context is done. Failed generations are
+// logged rather than returned, so that a template can be fixed while watching
+func WatchAndGenerate (ctx context.Context, a *app.Application, meta Metadata,
+	graph_data Graphdata, path string) error {
+
+	// Templates are read from the given path unless configured otherwise
+	template_dir := meta.Template_dir
+	if template_dir == "" {
+		template_dir = path + "/templates"
+	}
+
+	// Closure: Generates the application, logging the outcome. Directories of an
+	// earlier generation (also from before watching) are reused
+	generate := func (reason string) {
+		err := generate_application(a, path, meta, graph_data, true)
+		if nil != err {
+			watch_log(meta, "Generation (" + reason + ") failed: " + err.Error())
+		} else {
+			watch_log(meta, "Generated (" + reason + ")")
+		}
+	}
+
+	snapshot, err := template_snapshot(template_dir)
+	if nil != err {
+		return err
+	}
+	generate("initial")
+
+	ticker := time.NewTicker(Watch_interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			current, err := template_snapshot(template_dir)
+			if nil != err {
+				watch_log(meta, "Unable to poll templates: " + err.Error())
+				continue
+			}
+			if changed := changed_templates(snapshot, current); changed != "" {
+				snapshot = current
+				generate(changed + " changed")
+			}
+		}
+	}
+}
+
+/*
+ *******************************************************************************
+ *                           Private Watch Functions                           *
+ *******************************************************************************
+*/
+
+// Returns the modification time and size of every file in the template directory
+func template_snapshot (template_dir string) (map[string]string, error) {
+	snapshot := map[string]string{}
+	entries, err := ioutil.ReadDir(template_dir)
+	if nil != err {
+		return nil, fmt.Errorf("Unable to read template dir (%s): %s", template_dir,
+			err.Error())
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			snapshot[entry.Name()] = fmt.Sprintf("%d:%d", entry.ModTime().UnixNano(),
+				entry.Size())
+		}
+	}
+	return snapshot, nil
+}
+
+// Returns the name of a template that was added, removed, or modified (if any)
+func changed_templates (before, after map[string]string) string {
+	for name, state := range after {
+		if before[name] != state {
+			return name
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// Passes a watch message to the log callback (if set)
+func watch_log (meta Metadata, message string) {
+	if nil != meta.Watch_log {
+		meta.Watch_log(message)
+	}
+}
@@ -0,0 +1,89 @@
+package gen
+
+import (
+
+	// Standard packages
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	// Custom packages
+	"app"
+	"graph"
+)
+
+/*
+ *******************************************************************************
+ *                                 Watch Tests                                 *
+ *******************************************************************************
+*/
+
+// Returns the next watch message, failing the test if none arrives in time
+func next_watch_message (t *testing.T, messages chan string) string {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a watch message")
+	}
+	return ""
+}
+
+func TestWatchAndGenerateRegenerates (t *testing.T) {
+	fake_commands(t)
+	original_interval := Watch_interval
+	Watch_interval = 10 * time.Millisecond
+	defer func () { Watch_interval = original_interval }()
+
+	template_dir, path := write_application_templates(t), t.TempDir()
+	a, graph_data := &app.Application{Name: "pkg"}, Graphdata{Graph: &graph.Graph{}}
+
+	// Watching starts from an earlier generation
+	err := GenerateApplication(a, path, Metadata{Template_dir: template_dir, 
+		Allow_empty: true}, graph_data)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	messages := make(chan string, 16)
+	meta := Metadata{Template_dir: template_dir, Allow_empty: true,
+		Watch_log: func (message string) { messages <- message }}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func () {
+		done <- WatchAndGenerate(ctx, a, meta, graph_data, path)
+	}()
+
+	if message := next_watch_message(t, messages); message != "Generated (initial)" {
+		t.Fatalf("initial generation: %s", message)
+	}
+
+	// Each change regenerates into the existing package directories
+	for _, version := range []string{"version 1", "version 22"} {
+		err := ioutil.WriteFile(filepath.Join(template_dir, "CMakeLists.tmpl"),
+			[]byte(version), 0666)
+		if nil != err {
+			t.Fatal(err)
+		}
+		message := next_watch_message(t, messages)
+		if !strings.HasPrefix(message, "Generated (") {
+			t.Fatalf("regeneration: %s", message)
+		}
+		output, err := ioutil.ReadFile(filepath.Join(path, "pkg", "CMakeLists.txt"))
+		if nil != err {
+			t.Fatal(err)
+		}
+		if string(output) != version {
+			t.Errorf("CMakeLists.txt = %q, expected %q", string(output), version)
+		}
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, expected context.Canceled", err)
+	}
+}
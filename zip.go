@@ -0,0 +1,123 @@
+package gen
+
+import (
+
+	// Standard packages
+	"archive/zip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	// Custom packages
+	"app"
+)
+
+/*
+ *******************************************************************************
+ *                         Public Function Definitions                         *
+ *******************************************************************************
+*/
+
+// Generates an application into a temporary directory, and writes it to 'out'
+// as a zip archive. Templates must be configured with meta.Template_dir, since
+// the temporary directory does not contain any
+func GenerateApplicationZip (a *app.Application, meta Metadata, graph_data Graphdata,
+	out io.Writer) error {
+
+	// Check: valid input
+	if nil == out {
+		return errors.New("bad argument: null pointer")
+	}
+
+	// Check: template directory (the temporary directory has none)
+	_, err := configured_template_dir(meta)
+	if nil != err {
+		return err
+	}
+
+	// Generate into a temporary directory (removed on return)
+	dir, err := ioutil.TempDir("", "gen-")
+	if nil != err {
+		return errors.New("Unable to create temporary dir: " + err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	meta.Filesystem = os_filesystem{}
+	err = GenerateApplication(a, dir, meta, graph_data)
+	if nil != err {
+		return err
+	}
+
+	// Archive the generated tree
+	err = write_zip(dir, out)
+	if nil != err {
+		return errors.New("Unable to write zip archive: " + err.Error())
+	}
+	return nil
+}
+
+/*
+ *******************************************************************************
+ *                            Private Zip Functions                            *
+ *******************************************************************************
+*/
+
+// Writes the tree below 'dir' to 'out' as a zip archive, with paths relative to
+// 'dir'. File modes are kept; symbolic links are stored with their target
+func write_zip (dir string, out io.Writer) error {
+	w := zip.NewWriter(out)
+
+	err := filepath.Walk(dir, func (path string, info os.FileInfo, err error) error {
+		if nil != err {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		// Describe the entry
+		rel, err := filepath.Rel(dir, path)
+		if nil != err {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if nil != err {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+		entry, err := w.CreateHeader(header)
+		if nil != err || info.IsDir() {
+			return err
+		}
+
+		// Write the content (the target, for symbolic links)
+		if 0 != info.Mode() & os.ModeSymlink {
+			target, err := os.Readlink(path)
+			if nil != err {
+				return err
+			}
+			_, err = io.WriteString(entry, target)
+			return err
+		}
+		f, err := os.Open(path)
+		if nil != err {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(entry, f)
+		return err
+	})
+	if nil != err {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}